@@ -0,0 +1,136 @@
+package zomdb
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/DerGut/zomdb/pkg/heap"
+)
+
+// backupEntryHeaderSize is the size of the key and value lengths preceding
+// each pair of a backup. A backup is a plain sequence of pairs, each encoded
+// as
+//
+//	keySize (uint16) | valueSize (uint32) | key | value
+//
+// with big-endian sizes. The stream ends after the last pair, there is no
+// header or trailer.
+const backupEntryHeaderSize = 6
+
+// Backup writes a consistent snapshot of all pairs to w. Other operations on
+// the DB are blocked until the backup completes or ctx is cancelled.
+func (d *DB) Backup(ctx context.Context, w io.Writer) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	buf := bufio.NewWriter(w)
+	header := make([]byte, backupEntryHeaderSize)
+
+	for key, value := range d.heap.All() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		binary.BigEndian.PutUint16(header[:2], uint16(len(key)))
+		binary.BigEndian.PutUint32(header[2:], uint32(len(value)))
+
+		for _, data := range [][]byte{header, key, value} {
+			if _, err := buf.Write(data); err != nil {
+				return fmt.Errorf("write: %w", err)
+			}
+		}
+	}
+
+	if err := d.heap.Err(); err != nil {
+		return fmt.Errorf("reading heap: %w", err)
+	}
+
+	if err := buf.Flush(); err != nil {
+		return fmt.Errorf("flush: %w", err)
+	}
+
+	return nil
+}
+
+// ErrNotEmpty is returned by Restore if the target database already holds
+// pairs.
+var ErrNotEmpty = errors.New("database not empty")
+
+// Restore opens the database at path like New and populates it with the
+// pairs of a backup read from r. It fails with ErrNotEmpty if the database
+// already holds pairs, so that a backup is never merged with other data.
+func Restore(ctx context.Context, path string, r io.Reader) (*DB, error) {
+	d, err := New(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.restore(ctx, bufio.NewReader(r)); err != nil {
+		d.Close()
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (d *DB) restore(ctx context.Context, r io.Reader) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for range d.heap.All() {
+		return ErrNotEmpty
+	}
+
+	if err := d.heap.Err(); err != nil {
+		return fmt.Errorf("reading heap: %w", err)
+	}
+
+	header := make([]byte, backupEntryHeaderSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if _, err := io.ReadFull(r, header); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("read entry header: %w", err)
+		}
+
+		keySize := binary.BigEndian.Uint16(header[:2])
+		valueSize := binary.BigEndian.Uint32(header[2:])
+
+		// Check the sizes before allocating, a corrupt header could ask for
+		// gigabytes.
+		if keySize == 0 || keySize > heap.MaxKeySize {
+			return fmt.Errorf("invalid key size %d", keySize)
+		}
+
+		if valueSize > heap.MaxValueSize {
+			return fmt.Errorf("invalid value size %d", valueSize)
+		}
+
+		data := make([]byte, uint64(keySize)+uint64(valueSize))
+		if _, err := io.ReadFull(r, data); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+
+			return fmt.Errorf("read entry: %w", err)
+		}
+
+		if err := d.heap.Set(data[:keySize], data[keySize:]); err != nil {
+			return fmt.Errorf("setting %q: %w", data[:keySize], err)
+		}
+	}
+
+	if err := d.heap.Sync(); err != nil {
+		return fmt.Errorf("syncing heap: %w", err)
+	}
+
+	return nil
+}
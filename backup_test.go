@@ -0,0 +1,113 @@
+package zomdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := New(filepath.Join(t.TempDir(), "src.zomdb"))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	defer db.Close()
+
+	want := map[string]string{"a": "1", "b": "", "c\x00": "3"}
+	for k, v := range want {
+		if err := db.Set(ctx, []byte(k), []byte(v)); err != nil {
+			t.Fatalf("set: %v", err)
+		}
+	}
+
+	if err := db.Delete(ctx, []byte("a")); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	delete(want, "a")
+
+	var buf bytes.Buffer
+	if err := db.Backup(ctx, &buf); err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+
+	restored, err := Restore(ctx, filepath.Join(t.TempDir(), "dst.zomdb"), &buf)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	defer restored.Close()
+
+	got := make(map[string]string)
+	for k, v := range restored.Scan(ctx, nil, nil) {
+		got[string(k)] = string(v)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("restored %d keys, want %d: %q", len(got), len(want), got)
+	}
+
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("got %q for key %q, want %q", got[k], k, v)
+		}
+	}
+}
+
+func TestRestoreTruncated(t *testing.T) {
+	// Header of a pair with a 3 byte key and a 5 byte value, but only the key.
+	data := []byte{0, 3, 0, 0, 0, 5, 'k', 'e', 'y'}
+
+	_, err := Restore(context.Background(), filepath.Join(t.TempDir(), "dst.zomdb"), bytes.NewReader(data))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("got error %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestRestoreCorrupt(t *testing.T) {
+	// Header of a pair with a 4 GiB value, followed by garbage.
+	data := []byte{0, 3, 0xFF, 0xFF, 0xFF, 0xFF, 'k', 'e', 'y'}
+
+	_, err := Restore(context.Background(), filepath.Join(t.TempDir(), "dst.zomdb"), bytes.NewReader(data))
+	if err == nil || !strings.Contains(err.Error(), "invalid value size") {
+		t.Fatalf("got error %v, want invalid value size", err)
+	}
+
+	// Header of a pair with an empty key.
+	data = []byte{0, 0, 0, 0, 0, 1, 'v'}
+
+	_, err = Restore(context.Background(), filepath.Join(t.TempDir(), "dst.zomdb"), bytes.NewReader(data))
+	if err == nil || !strings.Contains(err.Error(), "invalid key size") {
+		t.Fatalf("got error %v, want invalid key size", err)
+	}
+}
+
+func TestRestoreNotEmpty(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "dst.zomdb")
+
+	db, err := New(path)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	if err := db.Set(ctx, []byte("a"), []byte("1")); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	// A backup holding a single pair.
+	data := []byte{0, 1, 0, 0, 0, 1, 'b', '2'}
+
+	_, err = Restore(ctx, path, bytes.NewReader(data))
+	if !errors.Is(err, ErrNotEmpty) {
+		t.Fatalf("got error %v, want %v", err, ErrNotEmpty)
+	}
+}
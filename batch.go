@@ -0,0 +1,71 @@
+package zomdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/DerGut/zomdb/pkg/heap"
+)
+
+// Batch collects writes in memory to apply them together. See DB.Batch.
+type Batch struct {
+	writes []batchWrite
+}
+
+type batchWrite struct {
+	key   []byte
+	value []byte
+	// deleted marks deletions, value is unset for them.
+	deleted bool
+}
+
+// Set buffers a write of the key.
+func (b *Batch) Set(key, value []byte) {
+	b.writes = append(b.writes, batchWrite{key: bytes.Clone(key), value: bytes.Clone(value)})
+}
+
+// Delete buffers a deletion of the key. Deleting a key that doesn't exist is
+// not an error.
+func (b *Batch) Delete(key []byte) {
+	b.writes = append(b.writes, batchWrite{key: bytes.Clone(key), deleted: true})
+}
+
+// Batch passes a new Batch to fn and applies its writes once fn returns
+// without error. The writes are applied in order and flushed to disk with a
+// single sync, which makes it much faster than individual Set calls for
+// bulk loads.
+//
+// If fn returns an error, no writes are applied and the error is returned.
+func (d *DB) Batch(fn func(*Batch) error) error {
+	var b Batch
+	if err := fn(&b); err != nil {
+		return err
+	}
+
+	d.writeOps.Add(uint64(len(b.writes)))
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, w := range b.writes {
+		if w.deleted {
+			err := d.heap.Delete(w.key)
+			if err != nil && !errors.Is(err, heap.ErrNotFound) {
+				return fmt.Errorf("deleting %q: %w", w.key, err)
+			}
+
+			continue
+		}
+
+		if err := d.heap.Set(w.key, w.value); err != nil {
+			return fmt.Errorf("setting %q: %w", w.key, err)
+		}
+	}
+
+	if err := d.heap.Sync(); err != nil {
+		return fmt.Errorf("syncing heap: %w", err)
+	}
+
+	return nil
+}
@@ -37,34 +37,80 @@ pub unsafe extern "C" fn create_heap(file_name_cstr: *const ffi::c_char) -> *mut
     unsafe { transmute(Box::new(heap)) }
 }
 
+/// Open an existing heap.
+///
+/// If the file doesn't exist, the global errno will be set to ERR_NOT_FOUND.
+///
+/// If an error occurs, the global errno will be set to the appropriate error.
+#[no_mangle]
+pub unsafe extern "C" fn open_heap(file_name_cstr: *const ffi::c_char) -> *mut Heap {
+    let file_name = match string_from_cstr(file_name_cstr) {
+        Ok(s) => s,
+        Err(e) => {
+            println!("zomdb: file_name: {:?}", e);
+            errno::set_errno(to_errno(zomdb::Error::Input(e)));
+            return std::ptr::null_mut();
+        }
+    };
+
+    let heap = match zomdb::Heap::open(file_name.into()) {
+        Ok(heap) => Heap { inner: heap },
+        Err(zomdb::Error::IO(e)) if e.kind() == std::io::ErrorKind::NotFound => {
+            errno::set_errno(errno::Errno(ERR_NOT_FOUND));
+            return std::ptr::null_mut();
+        }
+        Err(e) => {
+            println!("zomdb: Heap::open: {:?}", e);
+            errno::set_errno(to_errno(e));
+            return std::ptr::null_mut();
+        }
+    };
+
+    unsafe { transmute(Box::new(heap)) }
+}
+
 /// Get a value from the heap.
 ///
-/// Returns a pointer to the value if found, or null if not found. If not
-/// found, the global errno will be set to ERR_NOT_FOUND.
+/// Copies the value into out_buf and returns its length. If the key is not
+/// found, the global errno will be set to ERR_NOT_FOUND. If out_buf is
+/// shorter than the value, the global errno will be set to ERR_VALUE_SIZE.
 ///
 /// If an error occurs, the global errno will be set to the appropriate error.
 ///
-/// The accepted key is a null-terminated string. Any calling code must
-/// therefore guarantee that no null bytes are present in the key.
+/// The key is passed with its length and may therefore contain null bytes.
 #[no_mangle]
-pub unsafe extern "C" fn heap_get(
+pub unsafe extern "C" fn heap_get_n(
     ptr: *mut Heap,
-    key_cstr: *const ffi::c_char,
-) -> *const ffi::c_char {
+    key: *const u8,
+    key_len: usize,
+    out_buf: *mut u8,
+    out_len: usize,
+) -> usize {
     let heap = unsafe { &mut *ptr };
 
-    let key = bytes_from_cstr(key_cstr);
+    let key = bytes_from_raw(key, key_len);
 
     match heap.inner.get(&key) {
-        Ok(Some(value)) => to_cstr(&value),
+        Ok(Some(value)) => {
+            if value.len() > out_len {
+                errno::set_errno(errno::Errno(ERR_VALUE_SIZE));
+                return 0;
+            }
+
+            if !value.is_empty() {
+                unsafe { std::ptr::copy_nonoverlapping(value.as_ptr(), out_buf, value.len()) };
+            }
+
+            value.len()
+        }
         Ok(None) => {
             errno::set_errno(errno::Errno(ERR_NOT_FOUND));
-            std::ptr::null()
+            0
         }
         Err(e) => {
             println!("zomdb: heap.get: {:?}", e);
             errno::set_errno(to_errno(e));
-            std::ptr::null()
+            0
         }
     }
 }
@@ -73,19 +119,20 @@ pub unsafe extern "C" fn heap_get(
 ///
 /// If an error occurs, the global errno will be set to the appropriate error.
 ///
-/// The accepted key and value are null-terminated strings. Any calling code
-/// must therefore guarantee that no null bytes are present in the key or
-/// value.
+/// The key and value are passed with their lengths and may therefore contain
+/// null bytes.
 #[no_mangle]
-pub unsafe extern "C" fn heap_set(
+pub unsafe extern "C" fn heap_set_n(
     ptr: *mut Heap,
-    key_cstr: *const ffi::c_char,
-    value_cstr: *const ffi::c_char,
+    key: *const u8,
+    key_len: usize,
+    value: *const u8,
+    value_len: usize,
 ) {
     let heap = unsafe { &mut *ptr };
 
-    let key = bytes_from_cstr(key_cstr);
-    let value = bytes_from_cstr(value_cstr);
+    let key = bytes_from_raw(key, key_len);
+    let value = bytes_from_raw(value, value_len);
 
     match heap.inner.put(&key, &value) {
         Ok(_) => {}
@@ -96,6 +143,71 @@ pub unsafe extern "C" fn heap_set(
     };
 }
 
+/// Delete a key from the heap.
+///
+/// If the key is not found, the global errno will be set to ERR_NOT_FOUND.
+///
+/// If an error occurs, the global errno will be set to the appropriate error.
+#[no_mangle]
+pub unsafe extern "C" fn heap_delete(ptr: *mut Heap, key: *const u8, key_len: usize) {
+    let heap = unsafe { &mut *ptr };
+
+    let key = bytes_from_raw(key, key_len);
+
+    match heap.inner.delete(&key) {
+        Ok(true) => {}
+        Ok(false) => errno::set_errno(errno::Errno(ERR_NOT_FOUND)),
+        Err(e) => {
+            println!("zomdb: heap.delete: {:?}", e);
+            errno::set_errno(to_errno(e));
+        }
+    };
+}
+
+/// Flush all written tuples of the heap to disk.
+///
+/// If an error occurs, the global errno will be set to the appropriate error.
+#[no_mangle]
+pub unsafe extern "C" fn heap_sync(ptr: *mut Heap) {
+    let heap = unsafe { &*ptr };
+
+    if let Err(e) = heap.inner.sync() {
+        println!("zomdb: heap.sync: {:?}", e);
+        errno::set_errno(to_errno(e));
+    }
+}
+
+/// Tuple counts of a heap, see heap_stats.
+#[repr(C)]
+pub struct HeapStats {
+    /// The number of tuples stored in the file, including overwritten ones
+    /// and tombstones.
+    tuple_count: u64,
+    /// The number of keys that currently have a value.
+    live_count: u64,
+}
+
+/// Count the tuples of the heap into out.
+///
+/// All tuples are read once. If an error occurs, the global errno will be
+/// set to the appropriate error.
+#[no_mangle]
+pub unsafe extern "C" fn heap_stats(ptr: *mut Heap, out: *mut HeapStats) {
+    let heap = unsafe { &*ptr };
+
+    match heap.inner.stats() {
+        Ok(stats) => {
+            let out = unsafe { &mut *out };
+            out.tuple_count = stats.tuple_count;
+            out.live_count = stats.live_count;
+        }
+        Err(e) => {
+            println!("zomdb: heap.stats: {:?}", e);
+            errno::set_errno(to_errno(e));
+        }
+    }
+}
+
 #[no_mangle]
 pub unsafe extern "C" fn destroy_heap(ptr: *mut Heap) {
     let heap = unsafe { Box::from_raw(ptr) };
@@ -123,9 +235,13 @@ pub unsafe extern "C" fn heap_iter_next(ptr: *mut HeapIter) -> *const HeapTuple
 
     match iter.inner.next() {
         Some(Ok(tuple)) => {
+            let (key, key_len) = into_raw(tuple.key);
+            let (value, value_len) = into_raw(tuple.value);
             let tuple = HeapTuple {
-                key: to_cstr(&tuple.key),
-                value: to_cstr(&tuple.value),
+                key,
+                key_len,
+                value,
+                value_len,
             };
             unsafe { transmute(Box::new(tuple)) }
         }
@@ -139,10 +255,21 @@ pub unsafe extern "C" fn heap_iter_next(ptr: *mut HeapIter) -> *const HeapTuple
 }
 
 /// HeapTuple is a key-value pair from a Heap.
+///
+/// Use heap_tuple_destroy to free it after use.
 #[repr(C)]
 pub struct HeapTuple {
-    key: *const ffi::c_char,
-    value: *const ffi::c_char,
+    key: *const u8,
+    key_len: usize,
+    value: *const u8,
+    value_len: usize,
+}
+
+#[no_mangle]
+pub unsafe extern "C" fn heap_tuple_destroy(ptr: *mut HeapTuple) {
+    let tuple = unsafe { Box::from_raw(ptr) };
+    drop(from_raw(tuple.key, tuple.key_len));
+    drop(from_raw(tuple.value, tuple.value_len));
 }
 
 #[no_mangle]
@@ -157,14 +284,24 @@ unsafe fn string_from_cstr(s: *const ffi::c_char) -> Result<String, zomdb::Input
     Ok(s.to_string())
 }
 
-unsafe fn bytes_from_cstr(s: *const ffi::c_char) -> Vec<u8> {
-    let cstr = unsafe { ffi::CStr::from_ptr(s) };
-    cstr.to_bytes().to_vec()
+unsafe fn bytes_from_raw(ptr: *const u8, len: usize) -> Vec<u8> {
+    if len == 0 {
+        // The pointer may be null for empty slices.
+        return Vec::new();
+    }
+
+    unsafe { std::slice::from_raw_parts(ptr, len) }.to_vec()
+}
+
+fn into_raw(bytes: Vec<u8>) -> (*const u8, usize) {
+    let len = bytes.len();
+    let ptr = Box::into_raw(bytes.into_boxed_slice()) as *const u8;
+    (ptr, len)
 }
 
-unsafe fn to_cstr(s: &[u8]) -> *const ffi::c_char {
-    let cstr = ffi::CString::new(s).unwrap();
-    cstr.into_raw()
+unsafe fn from_raw(ptr: *const u8, len: usize) -> Box<[u8]> {
+    let slice = std::ptr::slice_from_raw_parts_mut(ptr as *mut u8, len);
+    unsafe { Box::from_raw(slice) }
 }
 
 /// Error code for keys that could not be found.
@@ -35,6 +35,49 @@ impl Heap {
         Ok(Self::new(file))
     }
 
+    /// Opens an existing Heap from the provided path.
+    ///
+    /// Unlike from, it fails if the path doesn't exist. All tuples are read
+    /// once to validate the file.
+    pub fn open(path: path::PathBuf) -> Result<Self, Error> {
+        let file = fs::OpenOptions::new()
+            .read(true)
+            .write(true)
+            .append(true)
+            .open(path)
+            .map_err(Error::IO)?;
+
+        let heap = Self::new(file);
+        for tuple in heap.iter() {
+            tuple?;
+        }
+
+        Ok(heap)
+    }
+
+    /// Flushes all written tuples to disk.
+    pub fn sync(&self) -> Result<(), Error> {
+        self.file.sync_all().map_err(Error::IO)
+    }
+
+    /// Counts the tuples of the heap.
+    ///
+    /// All tuples are read once, which is as expensive as a full iteration.
+    pub fn stats(&self) -> Result<Stats, Error> {
+        let mut iter = self.iter();
+
+        let mut live_count = 0;
+        for tuple in &mut iter {
+            tuple?;
+            live_count += 1;
+        }
+
+        Ok(Stats {
+            tuple_count: iter.tuples_read,
+            live_count,
+        })
+    }
+
     /// Returns an Iter that starts iterating from the last inserted tuple.
     pub fn iter(&self) -> Iter<'_> {
         Iter {
@@ -49,18 +92,34 @@ impl Heap {
             overflow: Vec::new(),
 
             seen_keys: HashSet::new(),
+            tuples_read: 0,
         }
     }
 }
 
+/// Tuple counts of a Heap.
+#[derive(Debug, PartialEq)]
+pub struct Stats {
+    /// The number of tuples stored in the file, including overwritten ones
+    /// and tombstones.
+    pub tuple_count: u64,
+    /// The number of keys that currently have a value.
+    pub live_count: u64,
+}
+
 /// On-disk representation of key-value pairs.
 #[derive(Debug, PartialEq)]
 pub struct HeapTuple {
     pub key: Vec<u8>,
     pub value: Vec<u8>,
+    /// Marks a tombstone that shadows all previous tuples with the same key.
+    pub deleted: bool,
 }
 
 impl HeapTuple {
+    /// The value size stored for tombstones. Real values are never this big.
+    const TOMBSTONE_VALUE_SIZE: usize = 0xFFFF;
+
     /// Creates a new HeapTuple from a known key-value pair.
     fn from(key: &[u8], value: &[u8]) -> Self {
         assert!(key.len() <= MAX_KEY_SIZE);
@@ -69,6 +128,18 @@ impl HeapTuple {
         HeapTuple {
             key: key.to_vec(),
             value: value.to_vec(),
+            deleted: false,
+        }
+    }
+
+    /// Creates a new tombstone for the key.
+    fn tombstone(key: &[u8]) -> Self {
+        assert!(key.len() <= MAX_KEY_SIZE);
+        assert!(!key.is_empty());
+        HeapTuple {
+            key: key.to_vec(),
+            value: Vec::new(),
+            deleted: true,
         }
     }
 
@@ -84,8 +155,14 @@ impl HeapTuple {
         let mut data = Vec::with_capacity(self.key.len() + self.value.len() + 1 + 2);
         data.extend_from_slice(&self.value);
         data.extend_from_slice(&self.key);
-        data.push((self.value.len() >> 8) as u8);
-        data.push(self.value.len() as u8);
+
+        let value_len = if self.deleted {
+            Self::TOMBSTONE_VALUE_SIZE
+        } else {
+            self.value.len()
+        };
+        data.push((value_len >> 8) as u8);
+        data.push(value_len as u8);
 
         // We use a single byte to encode the key size which allows to store
         // the value 255 as a maximum. We also require keys to be of at least
@@ -109,6 +186,14 @@ impl HeapTuple {
         }
 
         let value_size = ((data[data.len() - 3] as usize) << 8) | data[data.len() - 2] as usize;
+        if value_size == Self::TOMBSTONE_VALUE_SIZE {
+            if data.len() < key_size + 3 {
+                return Err(DeserializationError::DataTooShort);
+            }
+
+            let key = &data[data.len() - 3 - key_size..data.len() - 3];
+            return Ok(Self::tombstone(key));
+        }
         if value_size > MAX_VALUE_SIZE {
             return Err(DeserializationError::ValueSizeTooBig);
         }
@@ -145,6 +230,8 @@ pub struct Iter<'a> {
     overflow: Vec<u8>,
 
     seen_keys: HashSet<Vec<u8>>,
+    // The number of tuples read so far, including skipped ones.
+    tuples_read: u64,
 }
 
 impl<'a> Iterator for Iter<'a> {
@@ -165,9 +252,13 @@ impl<'a> Iter<'a> {
             self.initialized = true;
         }
 
-        while self.file_bytes_remaining() > 0 {
-            self.seek()?; // This call could be avoided if this run is reentrant
+        loop {
             if self.buffer_bytes_remaining() == 0 {
+                if self.file_bytes_remaining() == 0 {
+                    break;
+                }
+
+                self.seek()?; // This call could be avoided if this run is reentrant
                 self.fill_chunk_buffer()?;
                 self.buffer_offset = 0;
             }
@@ -191,6 +282,7 @@ impl<'a> Iter<'a> {
                 };
 
                 self.buffer_offset += tuple.disk_len();
+                self.tuples_read += 1;
 
                 if self.seen_keys.contains(&tuple.key) {
                     // We've already seen a more recent tuple with this key.
@@ -198,10 +290,13 @@ impl<'a> Iter<'a> {
                 }
                 self.seen_keys.insert(tuple.key.clone());
 
+                if tuple.deleted {
+                    // The key was deleted, older tuples are shadowed as well.
+                    continue;
+                }
+
                 return Ok(Some(tuple));
             }
-
-            self.file_offset -= self.buffer_offset as u64;
         }
 
         Ok(None)
@@ -237,6 +332,10 @@ impl<'a> Iter<'a> {
             .read_exact(&mut self.chunk_buffer)
             .map_err(Error::IO)?;
 
+        // file_offset always points right after the bytes that haven't been
+        // read into a chunk yet.
+        self.file_offset -= new_chunk_size as u64;
+
         if !self.overflow.is_empty() {
             // Empties self.overflow into chunk_buffer
             self.chunk_buffer.append(&mut self.overflow);
@@ -275,6 +374,22 @@ impl Index for Heap {
 
         Ok(None)
     }
+
+    fn delete(&mut self, key: &[u8]) -> Result<bool, Error> {
+        if key.len() > MAX_KEY_SIZE || key.is_empty() {
+            return Err(Error::Input(InputError::KeySize(key.len())));
+        }
+
+        if self.get(key)?.is_none() {
+            return Ok(false);
+        }
+
+        let bytes = HeapTuple::tombstone(key).serialize();
+
+        self.file.write_all(bytes.as_slice()).map_err(Error::IO)?;
+
+        Ok(true)
+    }
 }
 
 #[cfg(test)]
@@ -425,6 +540,115 @@ mod test {
         assert!(tuple3.is_none());
     }
 
+    #[test]
+    fn test_heap_open() {
+        let dir = std::env::temp_dir().join(format!("zomdb-test-open-{}", std::process::id()));
+        fs::create_dir_all(&dir).unwrap();
+        let path = dir.join("heap.zomdb");
+
+        let err = Heap::open(path.clone()).err().unwrap();
+        assert!(matches!(err, Error::IO(e) if e.kind() == io::ErrorKind::NotFound));
+
+        let mut heap = Heap::from(path.clone()).unwrap();
+        heap.put(b"key", b"value").unwrap();
+        drop(heap);
+
+        let mut heap = Heap::open(path.clone()).unwrap();
+        assert_eq!(heap.get(b"key").unwrap(), Some(b"value".to_vec()));
+
+        // A tuple with an invalid value size
+        heap.file.write_all(&[b'k', 0xFF, 0x00, 0]).unwrap();
+        drop(heap);
+
+        let err = Heap::open(path).err().unwrap();
+        assert!(matches!(err, Error::Data(_)));
+
+        fs::remove_dir_all(dir).unwrap();
+    }
+
+    #[test]
+    fn test_heap_sync() {
+        let mut heap = Heap::new(tempfile().unwrap());
+        heap.put(b"key", b"value").unwrap();
+        heap.sync().unwrap();
+
+        assert_eq!(heap.get(b"key").unwrap(), Some(b"value".to_vec()));
+    }
+
+    #[test]
+    fn test_heap_stats() {
+        let mut heap = Heap::new(tempfile().unwrap());
+        heap.put(b"key1", b"value1").unwrap();
+        heap.put(b"key1", b"value2").unwrap();
+        heap.put(b"key2", b"value1").unwrap();
+        heap.put(b"key3", b"value1").unwrap();
+        assert!(heap.delete(b"key3").unwrap());
+
+        assert_eq!(
+            heap.stats().unwrap(),
+            Stats {
+                tuple_count: 5,
+                live_count: 2,
+            }
+        );
+    }
+
+    #[test]
+    fn test_heap_tombstone_serde() {
+        let serialized = HeapTuple::tombstone(b"key").serialize();
+        assert_eq!(serialized, vec![b'k', b'e', b'y', 0xFF, 0xFF, 2]);
+
+        let deserialized = HeapTuple::deserialize(&serialized).unwrap();
+        assert_eq!(deserialized, HeapTuple::tombstone(b"key"));
+    }
+
+    #[test]
+    fn test_heap_delete() {
+        let heap_file = tempfile().unwrap();
+        let mut heap = Heap::new(heap_file);
+
+        heap.put(b"key1", b"value1").unwrap();
+        heap.put(b"key2", b"value2").unwrap();
+
+        assert!(heap.delete(b"key1").unwrap());
+        assert!(!heap.delete(b"key1").unwrap());
+        assert!(!heap.delete(b"key3").unwrap());
+
+        assert_eq!(heap.get(b"key1").unwrap(), None);
+        assert_eq!(heap.get(b"key2").unwrap(), Some(b"value2".to_vec()));
+
+        let tuples: Vec<_> = heap.iter().map(|t| t.unwrap()).collect();
+        assert_eq!(tuples, vec![HeapTuple::from(b"key2", b"value2")]);
+
+        heap.put(b"key1", b"value3").unwrap();
+        assert_eq!(heap.get(b"key1").unwrap(), Some(b"value3".to_vec()));
+    }
+
+    #[test]
+    fn test_heap_iter_handles_many_chunks() {
+        let heap_file = tempfile().unwrap();
+        let mut heap = Heap::new(heap_file);
+
+        // Tuples of 19 bytes don't align with the chunk size, so many of
+        // them span chunk boundaries.
+        let n = 2500;
+        for i in 0..n {
+            let key = format!("key_{:04}", i);
+            heap.put(key.as_bytes(), key.as_bytes()).unwrap();
+        }
+
+        let mut count = 0;
+        for (i, tuple) in heap.iter().enumerate() {
+            let key = format!("key_{:04}", n - 1 - i);
+            assert_eq!(
+                tuple.unwrap(),
+                HeapTuple::from(key.as_bytes(), key.as_bytes())
+            );
+            count += 1;
+        }
+        assert_eq!(count, n);
+    }
+
     #[test]
     fn test_heap_iter_handles_chunk_spanning_tuples() {
         let heap_file = tempfile().unwrap();
@@ -6,7 +6,7 @@ use std::{
 
 mod heap;
 
-pub use heap::{Heap, HeapTuple, Iter};
+pub use heap::{Heap, HeapTuple, Iter, Stats};
 
 /// The maximum byte size of keys.
 const MAX_KEY_SIZE: usize = 256;
@@ -17,6 +17,8 @@ const MAX_VALUE_SIZE: usize = 1024;
 pub trait Index {
     fn put(&mut self, key: &[u8], value: &[u8]) -> Result<(), Error>;
     fn get(&mut self, key: &[u8]) -> Result<Option<Vec<u8>>, Error>;
+    /// Removes the key. Returns false if the key didn't exist.
+    fn delete(&mut self, key: &[u8]) -> Result<bool, Error>;
 }
 
 #[derive(Debug)]
@@ -2,16 +2,30 @@ package zomdb_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 
 	"github.com/DerGut/zomdb"
 )
 
 func Example() {
-	db, err := zomdb.New()
+	dir, err := os.MkdirTemp("", "zomdb")
 	if err != nil {
 		panic(err)
 	}
+	defer os.RemoveAll(dir)
+
+	db, err := zomdb.New(filepath.Join(dir, "example.zomdb"))
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			panic(err)
+		}
+	}()
 
 	if err := db.Set(context.Background(), []byte("key"), []byte("value")); err != nil {
 		panic(err)
@@ -25,3 +39,198 @@ func Example() {
 	fmt.Printf("%q\n", value)
 	// Output: "value"
 }
+
+func ExampleDB_Delete() {
+	dir, err := os.MkdirTemp("", "zomdb")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := zomdb.New(filepath.Join(dir, "delete.zomdb"))
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			panic(err)
+		}
+	}()
+
+	if err := db.Set(context.Background(), []byte("key"), []byte("value")); err != nil {
+		panic(err)
+	}
+
+	if err := db.Delete(context.Background(), []byte("key")); err != nil {
+		panic(err)
+	}
+
+	_, err = db.Get(context.Background(), []byte("key"))
+	fmt.Println(errors.Is(err, zomdb.ErrNotFound))
+	// Output: true
+}
+
+func ExampleDB_Scan() {
+	dir, err := os.MkdirTemp("", "zomdb")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := zomdb.New(filepath.Join(dir, "scan.zomdb"))
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			panic(err)
+		}
+	}()
+
+	for _, key := range []string{"scan_c", "scan_a", "scan_b", "scan_d"} {
+		if err := db.Set(context.Background(), []byte(key), []byte("value")); err != nil {
+			panic(err)
+		}
+	}
+
+	for key := range db.Scan(context.Background(), []byte("scan_a"), []byte("scan_c")) {
+		fmt.Printf("%s\n", key)
+	}
+	// Output:
+	// scan_a
+	// scan_b
+	// scan_c
+}
+
+func ExampleDB_Begin() {
+	dir, err := os.MkdirTemp("", "zomdb")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := zomdb.New(filepath.Join(dir, "begin.zomdb"))
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			panic(err)
+		}
+	}()
+
+	ctx := context.Background()
+	if err := db.Set(ctx, []byte("tx_from"), []byte("10")); err != nil {
+		panic(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		panic(err)
+	}
+
+	if err := tx.Delete(ctx, []byte("tx_from")); err != nil {
+		panic(err)
+	}
+
+	if err := tx.Set(ctx, []byte("tx_to"), []byte("10")); err != nil {
+		panic(err)
+	}
+
+	// The deletion is only visible within the transaction until it commits.
+	_, err = tx.Get(ctx, []byte("tx_from"))
+	fmt.Println(errors.Is(err, zomdb.ErrNotFound))
+
+	if _, err := db.Get(ctx, []byte("tx_from")); err != nil {
+		panic(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		panic(err)
+	}
+
+	_, err = db.Get(ctx, []byte("tx_from"))
+	fmt.Println(errors.Is(err, zomdb.ErrNotFound))
+
+	value, err := db.Get(ctx, []byte("tx_to"))
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("%s\n", value)
+	// Output:
+	// true
+	// true
+	// 10
+}
+
+func ExampleDB_Batch() {
+	dir, err := os.MkdirTemp("", "zomdb")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := zomdb.New(filepath.Join(dir, "batch.zomdb"))
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			panic(err)
+		}
+	}()
+
+	err = db.Batch(func(b *zomdb.Batch) error {
+		for i := range 3 {
+			b.Set([]byte(fmt.Sprintf("batch_%d", i)), []byte("value"))
+		}
+
+		b.Delete([]byte("batch_1"))
+
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	for key := range db.Scan(context.Background(), []byte("batch_0"), []byte("batch_9")) {
+		fmt.Printf("%s\n", key)
+	}
+	// Output:
+	// batch_0
+	// batch_2
+}
+
+func ExampleDB_Stats() {
+	dir, err := os.MkdirTemp("", "zomdb")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := zomdb.New(filepath.Join(dir, "stats.zomdb"))
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			panic(err)
+		}
+	}()
+
+	ctx := context.Background()
+	for _, key := range []string{"a", "b", "c"} {
+		if err := db.Set(ctx, []byte(key), []byte("value")); err != nil {
+			panic(err)
+		}
+	}
+
+	if _, err := db.Get(ctx, []byte("a")); err != nil {
+		panic(err)
+	}
+
+	stats := db.Stats()
+	fmt.Println(stats.KeyCount, stats.ReadOps, stats.WriteOps, stats.DiskBytes > 0)
+	// Output: 3 1 3 true
+}
@@ -2,12 +2,6 @@ module github.com/DerGut/zomdb
 
 go 1.22
 
-require (
-	github.com/fxamacker/cbor/v2 v2.7.0
-	github.com/spf13/afero v1.9.2
-)
+require github.com/spf13/afero v1.9.2
 
-require (
-	github.com/x448/float16 v0.8.4 // indirect
-	golang.org/x/text v0.3.4 // indirect
-)
+require golang.org/x/text v0.3.4 // indirect
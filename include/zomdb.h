@@ -53,37 +53,96 @@ typedef struct HeapIter HeapIter;
 
 /**
  * HeapTuple is a key-value pair from a Heap.
+ *
+ * Use heap_tuple_destroy to free it after use.
  */
 typedef struct HeapTuple {
-  const char *key;
-  const char *value;
+  const uint8_t *key;
+  uintptr_t key_len;
+  const uint8_t *value;
+  uintptr_t value_len;
 } HeapTuple;
 
+/**
+ * Tuple counts of a heap, see heap_stats.
+ */
+typedef struct HeapStats {
+  /**
+   * The number of tuples stored in the file, including overwritten ones
+   * and tombstones.
+   */
+  uint64_t tuple_count;
+  /**
+   * The number of keys that currently have a value.
+   */
+  uint64_t live_count;
+} HeapStats;
+
 struct Heap *create_heap(const char *file_name_cstr);
 
+/**
+ * Open an existing heap.
+ *
+ * If the file doesn't exist, the global errno will be set to ERR_NOT_FOUND.
+ *
+ * If an error occurs, the global errno will be set to the appropriate error.
+ */
+struct Heap *open_heap(const char *file_name_cstr);
+
 /**
  * Get a value from the heap.
  *
- * Returns a pointer to the value if found, or null if not found. If not
- * found, the global errno will be set to ERR_NOT_FOUND.
+ * Copies the value into out_buf and returns its length. If the key is not
+ * found, the global errno will be set to ERR_NOT_FOUND. If out_buf is
+ * shorter than the value, the global errno will be set to ERR_VALUE_SIZE.
  *
  * If an error occurs, the global errno will be set to the appropriate error.
  *
- * The accepted key is a null-terminated string. Any calling code must
- * therefore guarantee that no null bytes are present in the key.
+ * The key is passed with its length and may therefore contain null bytes.
  */
-const char *heap_get(struct Heap *ptr, const char *key_cstr);
+uintptr_t heap_get_n(struct Heap *ptr,
+                     const uint8_t *key,
+                     uintptr_t key_len,
+                     uint8_t *out_buf,
+                     uintptr_t out_len);
 
 /**
  * Set a key and value in the heap.
  *
  * If an error occurs, the global errno will be set to the appropriate error.
  *
- * The accepted key and value are null-terminated strings. Any calling code
- * must therefore guarantee that no null bytes are present in the key or
- * value.
+ * The key and value are passed with their lengths and may therefore contain
+ * null bytes.
+ */
+void heap_set_n(struct Heap *ptr,
+                const uint8_t *key,
+                uintptr_t key_len,
+                const uint8_t *value,
+                uintptr_t value_len);
+
+/**
+ * Delete a key from the heap.
+ *
+ * If the key is not found, the global errno will be set to ERR_NOT_FOUND.
+ *
+ * If an error occurs, the global errno will be set to the appropriate error.
+ */
+void heap_delete(struct Heap *ptr, const uint8_t *key, uintptr_t key_len);
+
+/**
+ * Flush all written tuples of the heap to disk.
+ *
+ * If an error occurs, the global errno will be set to the appropriate error.
+ */
+void heap_sync(struct Heap *ptr);
+
+/**
+ * Count the tuples of the heap into out.
+ *
+ * All tuples are read once. If an error occurs, the global errno will be
+ * set to the appropriate error.
  */
-void heap_set(struct Heap *ptr, const char *key_cstr, const char *value_cstr);
+void heap_stats(struct Heap *ptr, struct HeapStats *out);
 
 void destroy_heap(struct Heap *ptr);
 
@@ -91,4 +150,6 @@ struct HeapIter *heap_iter(struct Heap *ptr);
 
 const struct HeapTuple *heap_iter_next(struct HeapIter *ptr);
 
+void heap_tuple_destroy(struct HeapTuple *ptr);
+
 void heap_iter_destroy(struct HeapIter *ptr);
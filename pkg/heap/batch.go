@@ -0,0 +1,65 @@
+package heap
+
+import "fmt"
+
+// BatchOp is a single write of a batch. It sets Key to Value, or deletes Key
+// if Delete is set.
+type BatchOp struct {
+	Key, Value []byte
+	Delete     bool
+}
+
+// BatchError is returned by Batch if one of its operations fails. Index is
+// the position of the failing operation.
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch op %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// Batch applies the operations in order and flushes them to disk with a
+// single sync.
+//
+// Key and value sizes are validated before anything is written, so invalid
+// operations fail the whole batch. Operations that fail while being applied,
+// e.g. deleting a key that doesn't exist, stop the batch and leave earlier
+// operations applied but unsynced. In both cases, a *BatchError is
+// returned.
+//
+// A batch isn't atomic. Its operations are written one by one, so a crash
+// in the middle leaves a prefix of them in the file. Batch doesn't lock the
+// heap either: callers must serialize it with all other access to the heap,
+// or concurrent readers may observe a partially applied batch.
+func (h *Heap) Batch(ops []BatchOp) error {
+	for i, op := range ops {
+		if len(op.Key) == 0 || len(op.Key) > MaxKeySize {
+			return &BatchError{Index: i, Err: errKeySize}
+		}
+
+		if len(op.Value) > MaxValueSize {
+			return &BatchError{Index: i, Err: errValueSize}
+		}
+	}
+
+	for i, op := range ops {
+		var err error
+		if op.Delete {
+			err = h.Delete(op.Key)
+		} else {
+			err = h.Set(op.Key, op.Value)
+		}
+
+		if err != nil {
+			return &BatchError{Index: i, Err: err}
+		}
+	}
+
+	return h.Sync()
+}
@@ -0,0 +1,72 @@
+package heap
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Compact rewrites the heap file so that it only holds the latest value of
+// each key, reclaiming the space of overwritten and deleted pairs.
+//
+// The pairs are written to a temporary file first, which then atomically
+// replaces the heap file. The insertion order of the pairs, as observed by
+// All, is preserved.
+func (h *Heap) Compact() error {
+	tmp := h.name + ".compact"
+	if err := os.Remove(tmp); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %w", errIO, err)
+	}
+
+	// All only yields the latest value of each key, in reverse insertion
+	// order.
+	type pair struct{ key, value []byte }
+
+	var pairs []pair
+	for key, value := range h.All() {
+		pairs = append(pairs, pair{key, value})
+	}
+
+	if err := h.Err(); err != nil {
+		return err
+	}
+
+	compacted, err := New(tmp)
+	if err != nil {
+		return err
+	}
+
+	for i := len(pairs) - 1; i >= 0; i-- {
+		if err := compacted.Set(pairs[i].key, pairs[i].value); err != nil {
+			compacted.Close()
+			return err
+		}
+	}
+
+	if err := compacted.Sync(); err != nil {
+		compacted.Close()
+		return err
+	}
+
+	if err := compacted.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, h.name); err != nil {
+		return fmt.Errorf("%w: %w", errIO, err)
+	}
+
+	reopened, err := Open(h.name)
+	if err != nil {
+		return err
+	}
+
+	if err := h.Close(); err != nil {
+		reopened.Close()
+		return err
+	}
+
+	*h = *reopened
+
+	return nil
+}
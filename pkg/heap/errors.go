@@ -0,0 +1,20 @@
+package heap
+
+import "errors"
+
+const (
+	// MaxKeySize is the maximum size of keys, see Heap.
+	MaxKeySize = 256
+	// MaxValueSize is the maximum size of values, see Heap.
+	MaxValueSize = 1024
+)
+
+var ErrNotFound = errors.New("zomdb: not found")
+
+var (
+	errIO        = errors.New("zomdb: io error")
+	errUTF8      = errors.New("zomdb: not utf8-encoded")
+	errKeySize   = errors.New("zomdb: invalid key size")
+	errValueSize = errors.New("zomdb: invalid value size")
+	errCorrupt   = errors.New("zomdb: corrupt data")
+)
@@ -0,0 +1,16 @@
+package heap
+
+// ForEach calls fn for each pair of the heap, in the same order as All,
+// until fn returns false. It is an alternative to All for callers that
+// can't use range-over-func.
+//
+// Unlike All, ForEach returns the error that stopped the iteration, if any.
+func (h *Heap) ForEach(fn func(key, value []byte) bool) error {
+	for key, value := range h.All() {
+		if !fn(key, value) {
+			break
+		}
+	}
+
+	return h.Err()
+}
@@ -1,33 +1,35 @@
+//go:build cgo && linux && amd64
+
 package heap
 
 /*
-#cgo darwin,arm64 LDFLAGS: -L${SRCDIR}/../../lib -lzomdb_darwin_arm64
-#cgo linux,arm64 LDFLAGS: -L${SRCDIR}/../../lib -lzomdb_linux_arm64
-#cgo linux,amd64 LDFLAGS: -L${SRCDIR}/../../lib -lzomdb_linux_amd64
+#cgo LDFLAGS: -L${SRCDIR}/../../lib -lzomdb_linux_amd64
 #cgo CFLAGS: -I${SRCDIR}/../../include
 #include "zomdb.h"
 */
 import "C"
 import (
-	"bytes"
-	"errors"
 	"fmt"
 	"iter"
 	"syscall"
 	"unsafe"
 )
 
-// Heap is an append-only log of key-value pairs.
+// Heap is an append-only log of key-value pairs, backed by the zomdb Rust
+// library.
 //
 // A Heap has the following limitations around key/ value choices:
-//   - Keys and values must be at least 1 byte in size
+//   - Keys must be at least 1 byte in size
 //   - Keys must be at most 256 bytes in size
 //   - Values must be at most 1024 bytes in size
-//   - Keys and values must not contain null bytes (this is a current
-//     limitation based on the fact, that the C API does not pass around byte
-//     array lengths)
+//
+// A Heap isn't safe for concurrent use.
 type Heap struct {
 	heap *C.struct_Heap
+	name string
+
+	// err is the error that stopped the last iteration.
+	err error
 }
 
 func New(fileName string) (*Heap, error) {
@@ -39,43 +41,66 @@ func New(fileName string) (*Heap, error) {
 		return nil, err
 	}
 
-	return &Heap{heap: heap}, nil
+	return &Heap{heap: heap, name: fileName}, nil
 }
 
-func (h *Heap) Close() {
+// Open opens an existing heap file. It returns ErrNotFound if the file
+// doesn't exist.
+func Open(fileName string) (*Heap, error) {
+	cs := C.CString(fileName)
+	defer C.free(unsafe.Pointer(cs))
+
+	heap, errno := C.open_heap(cs)
+	if err := goErr(errno); err != nil {
+		return nil, err
+	}
+
+	return &Heap{heap: heap, name: fileName}, nil
+}
+
+// Close releases the heap. The Rust library closes the file without
+// reporting errors, so the returned error is currently always nil.
+func (h *Heap) Close() error {
 	C.destroy_heap(h.heap)
+	return nil
 }
 
 func (h *Heap) Get(key []byte) ([]byte, error) {
-	if bytes.Contains(key, []byte{0}) {
-		return nil, errors.New("key contains null byte")
-	}
+	ck := C.CBytes(key)
+	defer C.free(ck)
 
-	ck := C.CString(string(key))
-	defer C.free(unsafe.Pointer(ck))
+	cv := (*C.uint8_t)(C.malloc(MaxValueSize))
+	defer C.free(unsafe.Pointer(cv))
 
-	cv, errno := C.heap_get(h.heap, ck)
+	n, errno := C.heap_get_n(h.heap, (*C.uint8_t)(ck), C.uintptr_t(len(key)), cv, MaxValueSize)
 	if err := goErr(errno); err != nil {
 		return nil, err
 	}
 
-	return []byte(C.GoString(cv)), nil
+	return C.GoBytes(unsafe.Pointer(cv), C.int(n)), nil
 }
 
 func (h *Heap) Set(key, value []byte) error {
-	switch {
-	case bytes.Contains(key, []byte{0}):
-		return errors.New("key contains null byte")
-	case bytes.Contains(value, []byte{0}):
-		return errors.New("value contains null byte")
+	ck := C.CBytes(key)
+	cv := C.CBytes(value)
+	defer C.free(ck)
+	defer C.free(cv)
+
+	_, errno := C.heap_set_n(h.heap, (*C.uint8_t)(ck), C.uintptr_t(len(key)), (*C.uint8_t)(cv), C.uintptr_t(len(value)))
+	if err := goErr(errno); err != nil {
+		return err
 	}
 
-	ck := C.CString(string(key))
-	cv := C.CString(string(value))
-	defer C.free(unsafe.Pointer(ck))
-	defer C.free(unsafe.Pointer(cv))
+	return nil
+}
+
+// Delete removes the key from the heap. It returns ErrNotFound if the key
+// doesn't exist.
+func (h *Heap) Delete(key []byte) error {
+	ck := C.CBytes(key)
+	defer C.free(ck)
 
-	_, errno := C.heap_set(h.heap, ck, cv)
+	_, errno := C.heap_delete(h.heap, (*C.uint8_t)(ck), C.uintptr_t(len(key)))
 	if err := goErr(errno); err != nil {
 		return err
 	}
@@ -83,18 +108,41 @@ func (h *Heap) Set(key, value []byte) error {
 	return nil
 }
 
+// Sync flushes all written pairs to disk.
+func (h *Heap) Sync() error {
+	_, errno := C.heap_sync(h.heap)
+	return goErr(errno)
+}
+
+// counts returns the number of records and live keys of the heap. The Rust
+// library reads all records to count them.
+func (h *Heap) counts() (entries, live int64, err error) {
+	var stats C.struct_HeapStats
+
+	_, errno := C.heap_stats(h.heap, &stats)
+	if err := goErr(errno); err != nil {
+		return 0, 0, err
+	}
+
+	return int64(stats.tuple_count), int64(stats.live_count), nil
+}
+
 // All returns an iterator over all values of the heap.
 //
-// Yielded values are ordered in reverse insertion order.
+// Yielded values are ordered in reverse insertion order. If reading fails,
+// the iteration stops and Err returns the error.
 func (h *Heap) All() iter.Seq2[[]byte, []byte] {
 	return func(yield func(k, v []byte) bool) {
+		h.err = nil
+
 		iter := C.heap_iter(h.heap)
 		defer C.heap_iter_destroy(iter)
 
 		for {
 			tuple, errno := C.heap_iter_next(iter)
 			if err := goErr(errno); err != nil {
-				panic(err)
+				h.err = err
+				return
 			}
 
 			if tuple == nil {
@@ -102,8 +150,9 @@ func (h *Heap) All() iter.Seq2[[]byte, []byte] {
 				return
 			}
 
-			goKey := []byte(C.GoString(tuple.key))
-			goValue := []byte(C.GoString(tuple.value))
+			goKey := C.GoBytes(unsafe.Pointer(tuple.key), C.int(tuple.key_len))
+			goValue := C.GoBytes(unsafe.Pointer(tuple.value), C.int(tuple.value_len))
+			C.heap_tuple_destroy(tuple)
 
 			if !yield(goKey, goValue) {
 				return
@@ -112,6 +161,11 @@ func (h *Heap) All() iter.Seq2[[]byte, []byte] {
 	}
 }
 
+// Err returns the error that stopped the last iteration, if any.
+func (h *Heap) Err() error {
+	return h.err
+}
+
 func goErr(err error) error {
 	if err == nil {
 		return nil
@@ -139,10 +193,10 @@ func goErr(err error) error {
 }
 
 var errnos = [...]error{
-	1:  errors.New("zomdb: not found"),
-	10: errors.New("zomdb: io error"),
-	30: errors.New("zomdb: not utf8-encoded"),
-	31: errors.New("zomdb: invalid key size"),
-	32: errors.New("zomdb: invalid value size"),
-	50: errors.New("zomdb: corrupt data"),
+	1:  ErrNotFound,
+	10: errIO,
+	30: errUTF8,
+	31: errKeySize,
+	32: errValueSize,
+	50: errCorrupt,
 }
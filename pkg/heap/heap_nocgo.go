@@ -0,0 +1,312 @@
+//go:build !cgo || !linux || !amd64
+
+package heap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"slices"
+)
+
+// Heap is an append-only log of key-value pairs, implemented in pure Go.
+// It is used without cgo and on platforms other than linux/amd64, which
+// is the only one with a prebuilt Rust library.
+//
+// A Heap has the following limitations around key/ value choices:
+//   - Keys must be at least 1 byte in size
+//   - Keys must be at most 256 bytes in size
+//   - Values must be at most 1024 bytes in size
+//
+// A Heap isn't safe for concurrent use.
+//
+// The file starts with a fixed-size header, followed by records of the form
+//
+//	keySize (uint16) | valueSize (uint16) | key | value
+//
+// A valueSize of tombstoneValueSize marks a deleted key. The offset of the
+// latest record of each key is kept in memory.
+//
+// The file format differs from that of the CGo Heap, files can't be shared
+// between both implementations.
+type Heap struct {
+	file *os.File
+	name string
+	size int64
+
+	// offsets maps each key to the offset of its latest record. Deleted
+	// keys are removed.
+	offsets map[string]int64
+
+	// records is the number of records in the file.
+	records int64
+
+	// err is the error that stopped the last iteration.
+	err error
+}
+
+// fileHeader identifies heap files. Its last byte is the format version.
+var fileHeader = []byte("zomdbhp\x01")
+
+const (
+	recordHeaderSize   = 4
+	tombstoneValueSize = 0xFFFF
+)
+
+// New opens the heap file or creates it if it doesn't exist yet.
+func New(fileName string) (*Heap, error) {
+	return open(fileName, os.O_RDWR|os.O_CREATE)
+}
+
+// Open opens an existing heap file. It returns ErrNotFound if the file
+// doesn't exist.
+func Open(fileName string) (*Heap, error) {
+	h, err := open(fileName, os.O_RDWR)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+
+	return h, err
+}
+
+func open(fileName string, flag int) (*Heap, error) {
+	f, err := os.OpenFile(fileName, flag, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errIO, err)
+	}
+
+	h := Heap{file: f, name: fileName, offsets: make(map[string]int64)}
+	if err := h.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &h, nil
+}
+
+// load validates the file header and indexes all records.
+func (h *Heap) load() error {
+	info, err := h.file.Stat()
+	if err != nil {
+		return fmt.Errorf("%w: %w", errIO, err)
+	}
+
+	if info.Size() == 0 {
+		// New file
+		if _, err := h.file.WriteAt(fileHeader, 0); err != nil {
+			return fmt.Errorf("%w: %w", errIO, err)
+		}
+
+		h.size = int64(len(fileHeader))
+
+		return nil
+	}
+
+	header := make([]byte, len(fileHeader))
+	if _, err := h.file.ReadAt(header, 0); err != nil || !bytes.Equal(header, fileHeader) {
+		return fmt.Errorf("%w: invalid file header", errCorrupt)
+	}
+
+	off := int64(len(fileHeader))
+	for off < info.Size() {
+		key, _, deleted, next, err := h.readRecord(off, false)
+		if err != nil {
+			return err
+		}
+
+		if next > info.Size() {
+			return fmt.Errorf("%w: truncated record", errCorrupt)
+		}
+
+		if deleted {
+			delete(h.offsets, string(key))
+		} else {
+			h.offsets[string(key)] = off
+		}
+
+		h.records++
+		off = next
+	}
+
+	h.size = off
+
+	return nil
+}
+
+func (h *Heap) Close() error {
+	if err := h.file.Close(); err != nil {
+		return fmt.Errorf("%w: %w", errIO, err)
+	}
+
+	return nil
+}
+
+func (h *Heap) Get(key []byte) ([]byte, error) {
+	off, ok := h.offsets[string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	_, value, _, _, err := h.readRecord(off, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+func (h *Heap) Set(key, value []byte) error {
+	if len(value) > MaxValueSize {
+		return errValueSize
+	}
+
+	off, err := h.append(key, value, false)
+	if err != nil {
+		return err
+	}
+
+	h.offsets[string(key)] = off
+
+	return nil
+}
+
+// Delete removes the key from the heap. It returns ErrNotFound if the key
+// doesn't exist.
+func (h *Heap) Delete(key []byte) error {
+	if _, ok := h.offsets[string(key)]; !ok {
+		return ErrNotFound
+	}
+
+	if _, err := h.append(key, nil, true); err != nil {
+		return err
+	}
+
+	delete(h.offsets, string(key))
+
+	return nil
+}
+
+// Sync flushes all written pairs to disk.
+func (h *Heap) Sync() error {
+	if err := h.file.Sync(); err != nil {
+		return fmt.Errorf("%w: %w", errIO, err)
+	}
+
+	return nil
+}
+
+// counts returns the number of records and live keys of the heap.
+func (h *Heap) counts() (entries, live int64, err error) {
+	return h.records, int64(len(h.offsets)), nil
+}
+
+// All returns an iterator over all values of the heap.
+//
+// Yielded values are ordered in reverse insertion order. If reading fails,
+// the iteration stops and Err returns the error.
+func (h *Heap) All() iter.Seq2[[]byte, []byte] {
+	return func(yield func(k, v []byte) bool) {
+		h.err = nil
+
+		offsets := make([]int64, 0, len(h.offsets))
+		for _, off := range h.offsets {
+			offsets = append(offsets, off)
+		}
+
+		slices.Sort(offsets)
+
+		for i := len(offsets) - 1; i >= 0; i-- {
+			key, value, _, _, err := h.readRecord(offsets[i], true)
+			if err != nil {
+				h.err = err
+				return
+			}
+
+			if !yield(key, value) {
+				return
+			}
+		}
+	}
+}
+
+// Err returns the error that stopped the last iteration, if any.
+func (h *Heap) Err() error {
+	return h.err
+}
+
+// append writes a new record to the end of the file and returns its offset.
+func (h *Heap) append(key, value []byte, deleted bool) (int64, error) {
+	if len(key) == 0 || len(key) > MaxKeySize {
+		return 0, errKeySize
+	}
+
+	valueSize := uint16(len(value))
+	if deleted {
+		valueSize = tombstoneValueSize
+	}
+
+	record := make([]byte, recordHeaderSize+len(key)+len(value))
+	binary.BigEndian.PutUint16(record[0:], uint16(len(key)))
+	binary.BigEndian.PutUint16(record[2:], valueSize)
+	copy(record[recordHeaderSize:], key)
+	copy(record[recordHeaderSize+len(key):], value)
+
+	off := h.size
+	if _, err := h.file.WriteAt(record, off); err != nil {
+		return 0, fmt.Errorf("%w: %w", errIO, err)
+	}
+
+	h.size += int64(len(record))
+	h.records++
+
+	return off, nil
+}
+
+// readRecord reads the record at off and returns the offset of the next
+// record. The value is only read if withValue is set.
+func (h *Heap) readRecord(off int64, withValue bool) (key, value []byte, deleted bool, next int64, err error) {
+	header := make([]byte, recordHeaderSize)
+	if _, err := h.file.ReadAt(header, off); err != nil {
+		return nil, nil, false, 0, readErr(err)
+	}
+
+	keySize := int(binary.BigEndian.Uint16(header[0:]))
+	valueSize := int(binary.BigEndian.Uint16(header[2:]))
+
+	if keySize == 0 || keySize > MaxKeySize {
+		return nil, nil, false, 0, fmt.Errorf("%w: key size %d", errCorrupt, keySize)
+	}
+
+	if valueSize == tombstoneValueSize {
+		deleted = true
+		valueSize = 0
+	} else if valueSize > MaxValueSize {
+		return nil, nil, false, 0, fmt.Errorf("%w: value size %d", errCorrupt, valueSize)
+	}
+
+	size := keySize
+	if withValue {
+		size += valueSize
+	}
+
+	data := make([]byte, size)
+	if _, err := h.file.ReadAt(data, off+recordHeaderSize); err != nil {
+		return nil, nil, false, 0, readErr(err)
+	}
+
+	next = off + recordHeaderSize + int64(keySize+valueSize)
+
+	return data[:keySize], data[keySize:], deleted, next, nil
+}
+
+func readErr(err error) error {
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: truncated record", errCorrupt)
+	}
+
+	return fmt.Errorf("%w: %w", errIO, err)
+}
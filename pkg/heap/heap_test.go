@@ -2,7 +2,9 @@ package heap_test
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -73,26 +75,139 @@ func TestHeapSetOverwrite(t *testing.T) {
 	}
 }
 
-func TestNullByte(t *testing.T) {
+func TestHeapDelete(t *testing.T) {
 	h := newTestHeap(t)
 
-	t.Run("setKey", func(t *testing.T) {
-		if err := h.Set([]byte("key\x00"), []byte("value")); err == nil {
-			t.Error("expected error")
-		}
+	if err := h.Set([]byte("color"), []byte("red")); err != nil {
+		t.Fatalf("set color=red: %v", err)
+	}
+
+	if err := h.Delete([]byte("color")); err != nil {
+		t.Fatalf("delete color: %v", err)
+	}
+
+	if _, err := h.Get([]byte("color")); !errors.Is(err, heap.ErrNotFound) {
+		t.Errorf("get color: expected ErrNotFound, got %v", err)
+	}
+
+	if err := h.Delete([]byte("color")); !errors.Is(err, heap.ErrNotFound) {
+		t.Errorf("delete color again: expected ErrNotFound, got %v", err)
+	}
+
+	for key := range h.All() {
+		t.Errorf("expected no keys, got %q", key)
+	}
+}
+
+func TestHeapBatch(t *testing.T) {
+	h := newTestHeap(t)
+
+	err := h.Batch([]heap.BatchOp{
+		{Key: []byte("a"), Value: []byte("1")},
+		{Key: []byte("b"), Value: []byte("1")},
+		{Key: []byte("a"), Value: []byte("2")},
+		{Key: []byte("b"), Delete: true},
 	})
+	if err != nil {
+		t.Fatalf("batch: %v", err)
+	}
 
-	t.Run("setValue", func(t *testing.T) {
-		if err := h.Set([]byte("key"), []byte("value\x00")); err == nil {
-			t.Error("expected error")
-		}
+	if value, err := h.Get([]byte("a")); err != nil || !bytes.Equal(value, []byte("2")) {
+		t.Errorf("get a: expected \"2\", got %q, %v", value, err)
+	}
+
+	if _, err := h.Get([]byte("b")); !errors.Is(err, heap.ErrNotFound) {
+		t.Errorf("get b: expected ErrNotFound, got %v", err)
+	}
+
+	// An invalid op fails the batch before anything is written.
+	err = h.Batch([]heap.BatchOp{
+		{Key: []byte("c"), Value: []byte("1")},
+		{Key: nil, Value: []byte("1")},
 	})
 
-	t.Run("get", func(t *testing.T) {
-		if _, err := h.Get([]byte("key\x00")); err == nil {
-			t.Error("expected error")
-		}
+	var batchErr *heap.BatchError
+	if !errors.As(err, &batchErr) || batchErr.Index != 1 {
+		t.Fatalf("expected batch error for op 1, got %v", err)
+	}
+
+	if _, err := h.Get([]byte("c")); !errors.Is(err, heap.ErrNotFound) {
+		t.Errorf("get c: expected ErrNotFound, got %v", err)
+	}
+
+	// Failing ops report their index and wrap the cause.
+	err = h.Batch([]heap.BatchOp{
+		{Key: []byte("c"), Value: []byte("1")},
+		{Key: []byte("missing"), Delete: true},
 	})
+
+	if !errors.As(err, &batchErr) || batchErr.Index != 1 || !errors.Is(err, heap.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for op 1, got %v", err)
+	}
+}
+
+func TestHeapOpen(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test.zomdb")
+
+	if _, err := heap.Open(name); !errors.Is(err, heap.ErrNotFound) {
+		t.Fatalf("open missing: expected ErrNotFound, got %v", err)
+	}
+
+	h, err := heap.New(name)
+	if err != nil {
+		t.Fatalf("new heap: %v", err)
+	}
+
+	if err := h.Set([]byte("key"), []byte("value")); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	if err := h.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	h, err = heap.Open(name)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer h.Close()
+
+	value, err := h.Get([]byte("key"))
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+
+	if !bytes.Equal(value, []byte("value")) {
+		t.Errorf("expected value to be \"value\", got %q", value)
+	}
+}
+
+func TestNullByte(t *testing.T) {
+	h := newTestHeap(t)
+
+	key, value := []byte("k\x00ey\x00"), []byte("\x00val\x00ue")
+	if err := h.Set(key, value); err != nil {
+		t.Fatalf("set: expected no error, got %v", err)
+	}
+
+	got, err := h.Get(key)
+	if err != nil {
+		t.Fatalf("get: expected no error, got %v", err)
+	}
+
+	if !bytes.Equal(got, value) {
+		t.Errorf("expected value to be %q, got %q", value, got)
+	}
+
+	for k, v := range h.All() {
+		if !bytes.Equal(k, key) || !bytes.Equal(v, value) {
+			t.Errorf("expected %q=%q, got %q=%q", key, value, k, v)
+		}
+	}
+
+	if _, err := h.Get([]byte("k")); err == nil {
+		t.Error("expected error for key prefix")
+	}
 }
 
 func TestHeapAll(t *testing.T) {
@@ -111,6 +226,269 @@ func TestHeapAll(t *testing.T) {
 	}
 }
 
+func TestHeapRange(t *testing.T) {
+	h := newTestHeap(t)
+
+	for _, key := range []string{"d", "b", "e", "a", "c", "b"} {
+		if err := h.Set([]byte(key), []byte("value_"+key)); err != nil {
+			t.Fatalf("set %s: %v", key, err)
+		}
+	}
+
+	tests := []struct {
+		lo, hi []byte
+		want   []string
+	}{
+		{[]byte("b"), []byte("d"), []string{"b", "c", "d"}},
+		{nil, []byte("b"), []string{"a", "b"}},
+		{[]byte("d"), nil, []string{"d", "e"}},
+		{nil, nil, []string{"a", "b", "c", "d", "e"}},
+		{[]byte("f"), nil, nil},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for key, value := range h.Range(tt.lo, tt.hi) {
+			if want := "value_" + string(key); string(value) != want {
+				t.Errorf("expected %q, got %q", want, value)
+			}
+
+			got = append(got, string(key))
+		}
+
+		if h.Err() != nil {
+			t.Fatalf("range: %v", h.Err())
+		}
+
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("range [%s, %s]: expected %v, got %v", tt.lo, tt.hi, tt.want, got)
+		}
+	}
+}
+
+func TestHeapRangeBatches(t *testing.T) {
+	h := newTestHeap(t)
+
+	// More keys than fit into a single batch
+	const n = 2500
+	for i := n - 1; i >= 0; i-- {
+		key := []byte(fmt.Sprintf("key_%04d", i))
+		if err := h.Set(key, key); err != nil {
+			t.Fatalf("set %s: %v", key, err)
+		}
+	}
+
+	next := 10
+	for key := range h.Range([]byte("key_0010"), nil) {
+		if want := fmt.Sprintf("key_%04d", next); string(key) != want {
+			t.Fatalf("expected %s, got %s", want, key)
+		}
+
+		next++
+	}
+
+	if h.Err() != nil {
+		t.Fatalf("range: %v", h.Err())
+	}
+
+	if next != n {
+		t.Fatalf("expected %d keys, got %d", n-10, next-10)
+	}
+}
+
+func TestHeapAllError(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test.zomdb")
+
+	h, err := heap.New(name)
+	if err != nil {
+		t.Fatalf("new heap: %v", err)
+	}
+	defer h.Close()
+
+	if err := h.Set([]byte("key"), []byte("value")); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	// Corrupt the file by overwriting it with invalid sizes.
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(name, bytes.Repeat([]byte{0x10}, int(info.Size())), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for key := range h.All() {
+		t.Errorf("expected no keys, got %q", key)
+	}
+
+	if h.Err() == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestHeapForEach(t *testing.T) {
+	h := newTestHeap(t)
+
+	for _, key := range []string{"a", "b", "c"} {
+		if err := h.Set([]byte(key), []byte(key)); err != nil {
+			t.Fatalf("set %s: %v", key, err)
+		}
+	}
+
+	var keys []string
+	err := h.ForEach(func(key, value []byte) bool {
+		keys = append(keys, string(key))
+		return len(keys) < 2
+	})
+	if err != nil {
+		t.Fatalf("for each: %v", err)
+	}
+
+	// Reverse insertion order, stopped after two keys
+	if len(keys) != 2 || keys[0] != "c" || keys[1] != "b" {
+		t.Errorf("expected [c b], got %v", keys)
+	}
+}
+
+func TestHeapForEachError(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test.zomdb")
+
+	h, err := heap.New(name)
+	if err != nil {
+		t.Fatalf("new heap: %v", err)
+	}
+	defer h.Close()
+
+	if err := h.Set([]byte("key"), []byte("value")); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	// Corrupt the file by overwriting it with invalid sizes.
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(name, bytes.Repeat([]byte{0x10}, int(info.Size())), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err = h.ForEach(func(key, value []byte) bool {
+		t.Errorf("expected no keys, got %q", key)
+		return true
+	})
+	if err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestHeapCompact(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test.zomdb")
+
+	h, err := heap.New(name)
+	if err != nil {
+		t.Fatalf("new heap: %v", err)
+	}
+	defer h.Close()
+
+	for _, kv := range [][2]string{{"a", "1"}, {"a", "2"}, {"b", "1"}, {"c", "1"}} {
+		if err := h.Set([]byte(kv[0]), []byte(kv[1])); err != nil {
+			t.Fatalf("set %s: %v", kv[0], err)
+		}
+	}
+
+	if err := h.Delete([]byte("c")); err != nil {
+		t.Fatalf("delete c: %v", err)
+	}
+
+	before, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.Compact(); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+
+	after, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if after.Size() >= before.Size() {
+		t.Errorf("expected file to shrink, got %d bytes from %d", after.Size(), before.Size())
+	}
+
+	if value, err := h.Get([]byte("a")); err != nil || !bytes.Equal(value, []byte("2")) {
+		t.Errorf("get a: expected \"2\", got %q, %v", value, err)
+	}
+
+	if _, err := h.Get([]byte("c")); !errors.Is(err, heap.ErrNotFound) {
+		t.Errorf("get c: expected ErrNotFound, got %v", err)
+	}
+
+	var keys []string
+	for key := range h.All() {
+		keys = append(keys, string(key))
+	}
+
+	// Reverse insertion order is preserved.
+	if len(keys) != 2 || keys[0] != "b" || keys[1] != "a" {
+		t.Errorf("expected [b a], got %v", keys)
+	}
+
+	// The heap is still writable.
+	if err := h.Set([]byte("d"), []byte("1")); err != nil {
+		t.Fatalf("set d: %v", err)
+	}
+}
+
+func TestHeapStats(t *testing.T) {
+	h := newTestHeap(t)
+
+	for _, kv := range [][2]string{{"a", "1"}, {"a", "2"}, {"b", "1"}, {"c", "1"}} {
+		if err := h.Set([]byte(kv[0]), []byte(kv[1])); err != nil {
+			t.Fatalf("set %s: %v", kv[0], err)
+		}
+	}
+
+	if err := h.Delete([]byte("c")); err != nil {
+		t.Fatalf("delete c: %v", err)
+	}
+
+	stats, err := h.Stats()
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+
+	if stats.EntryCount != 5 || stats.LiveEntryCount != 2 {
+		t.Errorf("expected 5 entries with 2 live ones, got %d and %d", stats.EntryCount, stats.LiveEntryCount)
+	}
+
+	if stats.DuplicateRatio != 0.6 {
+		t.Errorf("expected duplicate ratio of 0.6, got %f", stats.DuplicateRatio)
+	}
+
+	if stats.FileSizeBytes == 0 {
+		t.Error("expected file size to be set")
+	}
+
+	if err := h.Compact(); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+
+	stats, err = h.Stats()
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+
+	if stats.EntryCount != 2 || stats.DuplicateRatio != 0 {
+		t.Errorf("expected no duplicates after compaction, got %+v", stats)
+	}
+}
+
 func FuzzHeapSet(f *testing.F) {
 	h := newTestHeap(f)
 
@@ -130,7 +508,11 @@ func newTestHeap(t testing.TB) *heap.Heap {
 		t.Fatalf("new heap: %v", err)
 	}
 
-	t.Cleanup(h.Close)
+	t.Cleanup(func() {
+		if err := h.Close(); err != nil {
+			t.Errorf("close: %v", err)
+		}
+	})
 
 	return h
 }
@@ -0,0 +1,71 @@
+package heap
+
+import (
+	"bytes"
+	"iter"
+	"slices"
+)
+
+// rangeBatchSize is the number of pairs Range keeps in memory at a time.
+const rangeBatchSize = 1024
+
+// Range returns an iterator over all pairs with lo <= key <= hi in key
+// order. A nil lo or hi leaves that side of the range unbounded.
+//
+// The heap isn't ordered on disk, so Range reads the whole heap for each
+// batch of rangeBatchSize pairs, keeping only the smallest keys it hasn't
+// yielded yet. If reading fails, the iteration stops and Err returns the
+// error.
+func (h *Heap) Range(lo, hi []byte) iter.Seq2[[]byte, []byte] {
+	return func(yield func(k, v []byte) bool) {
+		type pair struct{ key, value []byte }
+
+		// last is the last yielded key, the next batch starts after it.
+		var last []byte
+		for {
+			var batch []pair
+			for key, value := range h.All() {
+				if lo != nil && bytes.Compare(key, lo) < 0 {
+					continue
+				}
+
+				if hi != nil && bytes.Compare(key, hi) > 0 {
+					continue
+				}
+
+				if last != nil && bytes.Compare(key, last) <= 0 {
+					continue
+				}
+
+				i, _ := slices.BinarySearchFunc(batch, key, func(p pair, key []byte) int {
+					return bytes.Compare(p.key, key)
+				})
+				if i == rangeBatchSize {
+					// Larger than all keys of this batch
+					continue
+				}
+
+				batch = slices.Insert(batch, i, pair{key, value})
+				if len(batch) > rangeBatchSize {
+					batch = batch[:rangeBatchSize]
+				}
+			}
+
+			if h.Err() != nil {
+				return
+			}
+
+			for _, p := range batch {
+				if !yield(p.key, p.value) {
+					return
+				}
+			}
+
+			if len(batch) < rangeBatchSize {
+				return
+			}
+
+			last = batch[len(batch)-1].key
+		}
+	}
+}
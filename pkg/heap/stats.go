@@ -0,0 +1,46 @@
+package heap
+
+import (
+	"fmt"
+	"os"
+)
+
+// HeapStats describes how much of the heap file is taken up by outdated
+// pairs. It can be used to decide when to Compact the heap.
+type HeapStats struct {
+	// EntryCount is the number of records in the file, including
+	// overwritten values and deletions.
+	EntryCount int64
+	// LiveEntryCount is the number of keys that currently have a value.
+	LiveEntryCount int64
+	// FileSizeBytes is the size of the heap file.
+	FileSizeBytes int64
+	// DuplicateRatio is the share of records that Compact would remove,
+	// i.e. (EntryCount - LiveEntryCount) / EntryCount.
+	DuplicateRatio float64
+}
+
+// Stats returns statistics about the heap file.
+func (h *Heap) Stats() (HeapStats, error) {
+	entries, live, err := h.counts()
+	if err != nil {
+		return HeapStats{}, err
+	}
+
+	info, err := os.Stat(h.name)
+	if err != nil {
+		return HeapStats{}, fmt.Errorf("%w: %w", errIO, err)
+	}
+
+	stats := HeapStats{
+		EntryCount:     entries,
+		LiveEntryCount: live,
+		FileSizeBytes:  info.Size(),
+	}
+
+	if entries > 0 {
+		stats.DuplicateRatio = float64(entries-live) / float64(entries)
+	}
+
+	return stats, nil
+}
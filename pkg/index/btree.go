@@ -0,0 +1,325 @@
+package index
+
+import (
+	"bytes"
+	"iter"
+	"slices"
+	"sort"
+)
+
+// btreeDegree is the minimum degree of the BTreeIndex. Each node except the
+// root holds between btreeDegree-1 and 2*btreeDegree-1 items.
+const btreeDegree = 32
+
+// BTreeIndex is an in-memory index that keeps its keys sorted in a B-tree.
+// Besides point lookups, it supports range scans over its keys.
+// The zero value is an empty index ready to use.
+type BTreeIndex struct {
+	root *btreeNode
+}
+
+var _ Index = &BTreeIndex{}
+
+type btreeItem struct {
+	key []byte
+	off int64
+}
+
+type btreeNode struct {
+	items []btreeItem
+	// children is empty for leaves and holds len(items)+1 nodes otherwise.
+	children []*btreeNode
+}
+
+func (b *BTreeIndex) PutOffset(key []byte, off int64) error {
+	item := btreeItem{key: bytes.Clone(key), off: off}
+
+	if b.root == nil {
+		b.root = &btreeNode{items: []btreeItem{item}}
+		return nil
+	}
+
+	if len(b.root.items) == 2*btreeDegree-1 {
+		// Grow the tree in height by splitting the full root.
+		root := &btreeNode{children: []*btreeNode{b.root}}
+		root.splitChild(0)
+		b.root = root
+	}
+
+	b.root.insert(item)
+
+	return nil
+}
+
+func (b *BTreeIndex) GetOffset(key []byte) (int64, error) {
+	n := b.root
+	for n != nil {
+		i, found := n.search(key)
+		if found {
+			return n.items[i].off, nil
+		}
+
+		if n.leaf() {
+			break
+		}
+
+		n = n.children[i]
+	}
+
+	return 0, ErrNotFound
+}
+
+func (b *BTreeIndex) Delete(key []byte) error {
+	if b.root == nil {
+		return nil
+	}
+
+	b.root.delete(key)
+
+	if len(b.root.items) == 0 {
+		// Shrink the tree in height, the root's last item was merged into
+		// its only child.
+		if b.root.leaf() {
+			b.root = nil
+		} else {
+			b.root = b.root.children[0]
+		}
+	}
+
+	return nil
+}
+
+// Range returns an iterator over all keys with lo <= key <= hi in key
+// order, together with their offsets. A nil lo or hi leaves that side of
+// the range unbounded.
+func (b *BTreeIndex) Range(lo, hi []byte) iter.Seq2[[]byte, int64] {
+	return func(yield func([]byte, int64) bool) {
+		if b.root != nil {
+			b.root.walk(lo, hi, yield)
+		}
+	}
+}
+
+func (n *btreeNode) leaf() bool {
+	return len(n.children) == 0
+}
+
+// search returns the index of the first item with a key >= key and whether
+// that item's key equals key.
+func (n *btreeNode) search(key []byte) (int, bool) {
+	i := sort.Search(len(n.items), func(i int) bool {
+		return bytes.Compare(n.items[i].key, key) >= 0
+	})
+
+	return i, i < len(n.items) && bytes.Equal(n.items[i].key, key)
+}
+
+// insert adds the item to the subtree or overwrites the offset of an
+// existing key. The node must not be full.
+func (n *btreeNode) insert(item btreeItem) {
+	for {
+		i, found := n.search(item.key)
+		if found {
+			n.items[i].off = item.off
+			return
+		}
+
+		if n.leaf() {
+			n.items = append(n.items, btreeItem{})
+			copy(n.items[i+1:], n.items[i:])
+			n.items[i] = item
+
+			return
+		}
+
+		if len(n.children[i].items) == 2*btreeDegree-1 {
+			n.splitChild(i)
+
+			// The child's median moved up to i, decide which half to
+			// descend into.
+			switch c := bytes.Compare(item.key, n.items[i].key); {
+			case c == 0:
+				n.items[i].off = item.off
+				return
+			case c > 0:
+				i++
+			}
+		}
+
+		n = n.children[i]
+	}
+}
+
+// splitChild splits the full child at index i into two nodes and moves its
+// median item up into n.
+func (n *btreeNode) splitChild(i int) {
+	child := n.children[i]
+	median := child.items[btreeDegree-1]
+
+	right := &btreeNode{
+		items: append([]btreeItem(nil), child.items[btreeDegree:]...),
+	}
+	if !child.leaf() {
+		right.children = append([]*btreeNode(nil), child.children[btreeDegree:]...)
+		child.children = child.children[:btreeDegree]
+	}
+	child.items = child.items[:btreeDegree-1]
+
+	n.items = append(n.items, btreeItem{})
+	copy(n.items[i+1:], n.items[i:])
+	n.items[i] = median
+
+	n.children = append(n.children, nil)
+	copy(n.children[i+2:], n.children[i+1:])
+	n.children[i+1] = right
+}
+
+// delete removes the key from the subtree. Every node it descends into is
+// first made to hold at least btreeDegree items, so that removing an item
+// never leaves a node with too few. The root is exempt from this.
+func (n *btreeNode) delete(key []byte) {
+	for {
+		i, found := n.search(key)
+
+		if n.leaf() {
+			if found {
+				n.items = slices.Delete(n.items, i, i+1)
+			}
+
+			return
+		}
+
+		if found {
+			// Replace the item with its predecessor or successor from a
+			// child that can spare an item, and delete that one instead.
+			switch {
+			case len(n.children[i].items) >= btreeDegree:
+				pred := n.children[i].max()
+				n.items[i] = pred
+				n, key = n.children[i], pred.key
+			case len(n.children[i+1].items) >= btreeDegree:
+				succ := n.children[i+1].min()
+				n.items[i] = succ
+				n, key = n.children[i+1], succ.key
+			default:
+				// The key moves down into the merged child.
+				n.merge(i)
+				n = n.children[i]
+			}
+
+			continue
+		}
+
+		if len(n.children[i].items) < btreeDegree {
+			i = n.fill(i)
+		}
+
+		n = n.children[i]
+	}
+}
+
+// fill makes the child at index i hold at least btreeDegree items by
+// borrowing an item from a sibling, or by merging it with one. It returns
+// the index of the child that now covers the child's keys.
+func (n *btreeNode) fill(i int) int {
+	child := n.children[i]
+
+	if i > 0 && len(n.children[i-1].items) >= btreeDegree {
+		// Rotate the left sibling's last item through n.
+		left := n.children[i-1]
+		child.items = slices.Insert(child.items, 0, n.items[i-1])
+		n.items[i-1] = left.items[len(left.items)-1]
+		left.items = left.items[:len(left.items)-1]
+
+		if !left.leaf() {
+			child.children = slices.Insert(child.children, 0, left.children[len(left.children)-1])
+			left.children = left.children[:len(left.children)-1]
+		}
+
+		return i
+	}
+
+	if i < len(n.items) && len(n.children[i+1].items) >= btreeDegree {
+		// Rotate the right sibling's first item through n.
+		right := n.children[i+1]
+		child.items = append(child.items, n.items[i])
+		n.items[i] = right.items[0]
+		right.items = slices.Delete(right.items, 0, 1)
+
+		if !right.leaf() {
+			child.children = append(child.children, right.children[0])
+			right.children = slices.Delete(right.children, 0, 1)
+		}
+
+		return i
+	}
+
+	if i == len(n.items) {
+		i--
+	}
+
+	n.merge(i)
+
+	return i
+}
+
+// merge merges the child at index i+1 and the item at index i into the
+// child at index i. Both children must hold btreeDegree-1 items.
+func (n *btreeNode) merge(i int) {
+	left, right := n.children[i], n.children[i+1]
+
+	left.items = append(left.items, n.items[i])
+	left.items = append(left.items, right.items...)
+	left.children = append(left.children, right.children...)
+
+	n.items = slices.Delete(n.items, i, i+1)
+	n.children = slices.Delete(n.children, i+1, i+2)
+}
+
+// min returns the item with the smallest key of the subtree.
+func (n *btreeNode) min() btreeItem {
+	for !n.leaf() {
+		n = n.children[0]
+	}
+
+	return n.items[0]
+}
+
+// max returns the item with the largest key of the subtree.
+func (n *btreeNode) max() btreeItem {
+	for !n.leaf() {
+		n = n.children[len(n.children)-1]
+	}
+
+	return n.items[len(n.items)-1]
+}
+
+// walk yields all items of the subtree within [lo, hi] in order. It returns
+// false if the iteration should stop.
+func (n *btreeNode) walk(lo, hi []byte, yield func([]byte, int64) bool) bool {
+	start := 0
+	if lo != nil {
+		start, _ = n.search(lo)
+	}
+
+	for i := start; i <= len(n.items); i++ {
+		if !n.leaf() && !n.children[i].walk(lo, hi, yield) {
+			return false
+		}
+
+		if i == len(n.items) {
+			break
+		}
+
+		item := n.items[i]
+		if hi != nil && bytes.Compare(item.key, hi) > 0 {
+			return false
+		}
+
+		if !yield(item.key, item.off) {
+			return false
+		}
+	}
+
+	return true
+}
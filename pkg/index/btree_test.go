@@ -0,0 +1,140 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestBTreeIndex(t *testing.T) {
+	var b BTreeIndex
+
+	const n = 10000
+	for _, i := range rand.Perm(n) {
+		if err := b.PutOffset([]byte(fmt.Sprintf("key%05d", i)), int64(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Overwrite
+	if err := b.PutOffset([]byte("key00042"), -1); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < n; i++ {
+		want := int64(i)
+		if i == 42 {
+			want = -1
+		}
+
+		off, err := b.GetOffset([]byte(fmt.Sprintf("key%05d", i)))
+		if err != nil {
+			t.Fatalf("key %d: %v", i, err)
+		}
+
+		if off != want {
+			t.Fatalf("key %d: expected offset %d, got %d", i, want, off)
+		}
+	}
+
+	if _, err := b.GetOffset([]byte("key")); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	tests := []struct {
+		lo, hi      []byte
+		first, last int
+	}{
+		{[]byte("key01000"), []byte("key01999"), 1000, 1999},
+		{[]byte("key009995"), []byte("key01000x"), 1000, 1000},
+		{nil, []byte("key00010"), 0, 10},
+		{[]byte("key09990"), nil, 9990, 9999},
+		{nil, nil, 0, n - 1},
+	}
+
+	for _, tt := range tests {
+		next := tt.first
+		for key := range b.Range(tt.lo, tt.hi) {
+			if want := fmt.Sprintf("key%05d", next); string(key) != want {
+				t.Fatalf("range [%s, %s]: expected %s, got %s", tt.lo, tt.hi, want, key)
+			}
+
+			next++
+		}
+
+		if next != tt.last+1 {
+			t.Fatalf("range [%s, %s]: expected last key %d, got %d", tt.lo, tt.hi, tt.last, next-1)
+		}
+	}
+
+	for range b.Range(nil, nil) {
+		break
+	}
+}
+
+func TestBTreeIndexDelete(t *testing.T) {
+	var b BTreeIndex
+
+	const n = 10000
+	for _, i := range rand.Perm(n) {
+		if err := b.PutOffset([]byte(fmt.Sprintf("key%05d", i)), int64(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Delete the odd keys in random order, and a key that doesn't exist.
+	for _, i := range rand.Perm(n) {
+		if i%2 == 1 {
+			if err := b.Delete([]byte(fmt.Sprintf("key%05d", i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := b.Delete([]byte("key")); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < n; i++ {
+		off, err := b.GetOffset([]byte(fmt.Sprintf("key%05d", i)))
+		if i%2 == 1 {
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("key %d: expected ErrNotFound, got %v", i, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("key %d: %v", i, err)
+		}
+
+		if off != int64(i) {
+			t.Fatalf("key %d: expected offset %d, got %d", i, i, off)
+		}
+	}
+
+	next := 0
+	for key := range b.Range(nil, nil) {
+		if want := fmt.Sprintf("key%05d", next); string(key) != want {
+			t.Fatalf("expected %s, got %s", want, key)
+		}
+
+		next += 2
+	}
+
+	if next != n {
+		t.Fatalf("expected %d keys, got %d", n/2, next/2)
+	}
+
+	for i := 0; i < n; i += 2 {
+		if err := b.Delete([]byte(fmt.Sprintf("key%05d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if b.root != nil {
+		t.Fatalf("expected empty tree, got root with %d items", len(b.root.items))
+	}
+}
@@ -1,6 +1,7 @@
 package index
 
-// Hash is an in-memory index that stores offsets in a hash map
+// Hash is an in-memory index that stores offsets in a hash map.
+// The zero value is an empty index ready to use.
 type Hash struct {
 	m map[string]int64
 }
@@ -8,6 +9,11 @@ type Hash struct {
 var _ Index = &Hash{}
 
 func (h *Hash) PutOffset(key []byte, off int64) error {
+	if h.m == nil {
+		// Allow using the zero value
+		h.m = make(map[string]int64)
+	}
+
 	h.m[string(key)] = off
 
 	return nil
@@ -21,3 +27,9 @@ func (h *Hash) GetOffset(key []byte) (int64, error) {
 
 	return off, nil
 }
+
+func (h *Hash) Delete(key []byte) error {
+	delete(h.m, string(key))
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package index
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	var h Hash
+
+	if _, err := h.GetOffset([]byte("key")); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := h.PutOffset([]byte("key"), 42); err != nil {
+		t.Fatal(err)
+	}
+
+	off, err := h.GetOffset([]byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if off != 42 {
+		t.Fatalf("expected offset 42, got %d", off)
+	}
+
+	if err := h.Delete([]byte("key")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := h.GetOffset([]byte("key")); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after delete, got %v", err)
+	}
+}
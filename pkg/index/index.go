@@ -7,4 +7,7 @@ var ErrNotFound = errors.New("not found")
 type Index interface {
 	PutOffset(key []byte, off int64) error
 	GetOffset(key []byte) (int64, error)
+	// Delete removes the key from the index. Deleting a key that isn't
+	// indexed is a no-op.
+	Delete(key []byte) error
 }
@@ -0,0 +1,155 @@
+package index
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/DerGut/zomdb/pkg/log"
+)
+
+// PersistentHash is a Hash index that persists all offsets to a log. Reads
+// are served from memory.
+//
+// Each PutOffset appends a record of the form
+//
+//	keyLen (uint16) | key | off (int64)
+//
+// Delete appends the same record without the offset.
+type PersistentHash struct {
+	log  *log.Log
+	hash Hash
+}
+
+var _ Index = &PersistentHash{}
+
+// OpenPersistentHash rebuilds the index by replaying all records of the log.
+//
+// A torn last record is ignored, since its PutOffset didn't complete. It is
+// cut from the log, so that later records don't follow it.
+func OpenPersistentHash(l *log.Log) (*PersistentHash, error) {
+	h := PersistentHash{log: l}
+
+	// last is the offset of the last valid record, if any.
+	last := int64(-1)
+	records, replayErr := l.Entries(0)
+	for pos, record := range records {
+		key, off, deleted, err := parseHashRecord(record)
+		if err != nil {
+			return nil, err
+		}
+
+		if deleted {
+			err = h.hash.Delete(key)
+		} else {
+			err = h.hash.PutOffset(key, off)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		last = pos
+	}
+
+	err := replayErr()
+	if err == nil {
+		return &h, nil
+	}
+
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("replay: %w", err)
+	}
+
+	// The torn record starts right after the last valid one.
+	var end int64
+	if last >= 0 {
+		_, next, err := l.ReadRecord(last)
+		if err != nil {
+			return nil, fmt.Errorf("read last record: %w", err)
+		}
+
+		end = next
+	}
+
+	if err := l.TruncateAt(end); err != nil {
+		return nil, fmt.Errorf("truncate torn record: %w", err)
+	}
+
+	return &h, nil
+}
+
+func (h *PersistentHash) PutOffset(key []byte, off int64) error {
+	if len(key) > math.MaxUint16 {
+		return fmt.Errorf("key too large: %d bytes", len(key))
+	}
+
+	record := make([]byte, 0, 2+len(key)+8)
+	record = binary.BigEndian.AppendUint16(record, uint16(len(key)))
+	record = append(record, key...)
+	record = binary.BigEndian.AppendUint64(record, uint64(off))
+
+	if err := h.appendRecord(record); err != nil {
+		return err
+	}
+
+	return h.hash.PutOffset(key, off)
+}
+
+func (h *PersistentHash) Delete(key []byte) error {
+	if len(key) > math.MaxUint16 {
+		return fmt.Errorf("key too large: %d bytes", len(key))
+	}
+
+	if _, err := h.hash.GetOffset(key); errors.Is(err, ErrNotFound) {
+		return nil
+	}
+
+	record := make([]byte, 0, 2+len(key))
+	record = binary.BigEndian.AppendUint16(record, uint16(len(key)))
+	record = append(record, key...)
+
+	if err := h.appendRecord(record); err != nil {
+		return err
+	}
+
+	return h.hash.Delete(key)
+}
+
+func (h *PersistentHash) appendRecord(record []byte) error {
+	if _, err := h.log.AppendRecord(record); err != nil {
+		return fmt.Errorf("append record: %w", err)
+	}
+
+	if err := h.log.Sync(); err != nil {
+		return fmt.Errorf("sync: %w", err)
+	}
+
+	return nil
+}
+
+func (h *PersistentHash) GetOffset(key []byte) (int64, error) {
+	return h.hash.GetOffset(key)
+}
+
+func parseHashRecord(record []byte) (key []byte, off int64, deleted bool, err error) {
+	if len(record) < 2 {
+		return nil, 0, false, errors.New("record too short")
+	}
+
+	keyLen := int(binary.BigEndian.Uint16(record))
+	switch len(record) {
+	case 2 + keyLen:
+		return record[2:], 0, true, nil
+	case 2 + keyLen + 8:
+	default:
+		return nil, 0, false, fmt.Errorf("invalid record size %d for key of size %d", len(record), keyLen)
+	}
+
+	key = record[2 : 2+keyLen]
+	off = int64(binary.BigEndian.Uint64(record[2+keyLen:]))
+
+	return key, off, false, nil
+}
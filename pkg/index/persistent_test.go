@@ -0,0 +1,85 @@
+package index
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DerGut/zomdb/pkg/log"
+	"github.com/spf13/afero"
+)
+
+func TestPersistentHash(t *testing.T) {
+	l, err := log.New(afero.NewMemMapFs())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := OpenPersistentHash(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, off := range map[string]int64{"a": 1, "b": 2, "c": 3} {
+		if err := h.PutOffset([]byte(key), off); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Overwrite
+	if err := h.PutOffset([]byte("a"), 4); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.Delete([]byte("c")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A partially written record
+	if _, err := l.Append([]byte{0, 0, 0, 20, 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenPersistentHash(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string]int64{"a": 4, "b": 2} {
+		off, err := reopened.GetOffset([]byte(key))
+		if err != nil {
+			t.Fatalf("key %s: %v", key, err)
+		}
+
+		if off != want {
+			t.Fatalf("key %s: expected offset %d, got %d", key, want, off)
+		}
+	}
+
+	for _, key := range []string{"c", "d"} {
+		if _, err := reopened.GetOffset([]byte(key)); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("key %s: expected ErrNotFound, got %v", key, err)
+		}
+	}
+	// Records appended after the torn one survive the next reopen.
+	for key, off := range map[string]int64{"c": 5, "d": 6} {
+		if err := reopened.PutOffset([]byte(key), off); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reopened, err = OpenPersistentHash(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string]int64{"a": 4, "b": 2, "c": 5, "d": 6} {
+		off, err := reopened.GetOffset([]byte(key))
+		if err != nil {
+			t.Fatalf("key %s: %v", key, err)
+		}
+
+		if off != want {
+			t.Fatalf("key %s: expected offset %d, got %d", key, want, off)
+		}
+	}
+}
@@ -2,38 +2,57 @@ package log
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
+	"iter"
+	"math"
 	"os"
 	"path/filepath"
 	"sync"
-	"time"
 
 	"github.com/spf13/afero"
 )
 
 const (
-	defaultLogDir = "/etc/zomdb/logs"
+	defaultLogDir         = "/etc/zomdb/logs"
+	defaultMaxSegmentSize = 64 << 20 // 64 MiB
 )
 
 var ErrNotFound = errors.New("not found")
 
+var ErrCorruptRecord = errors.New("corrupt record")
+
 var errNoNew = errors.New("use log.New() to create a Log")
 
 // Log abstracts a log that is split into multiple files
 // It provides an API to read from any point but only append
 // to the latest entry.
 // It implements the io.Closer, io.ReaderAt and io.Writer interfaces
-// TODO: think about concurrent operations, the Log SHOULD be safe
-// for concurrent use
+//
+// A Log is safe for concurrent use.
 type Log struct {
-	fs afero.Fs
+	fs  afero.Fs
+	dir string
+
+	// writeLock serializes writers. It is held for the duration of each
+	// write, so that concurrent appends don't interleave.
+	writeLock sync.Mutex
+
+	// lock guards size and segments. Readers hold it while reading from
+	// the segments, writers only while updating the fields. Since only
+	// writers modify them, writers may read them without holding lock.
+	lock sync.RWMutex
 
 	size int64
 
+	// segments are ordered from oldest to newest, only the newest segment
+	// is written to.
 	segments []segment
-	lock     sync.Mutex
+
+	maxSegmentSize int64
 
 	compact CompactionFunc
 }
@@ -51,19 +70,104 @@ var _ io.ReaderAt = &Log{}
 
 var _ io.Writer = &Log{}
 
+// Syncer is implemented by types that can commit written data to stable
+// storage.
+type Syncer interface {
+	Sync() error
+}
+
+var _ Syncer = &Log{}
+
+type LogOptions struct {
+	// Dir is the directory the segments are stored in. It is created if it
+	// doesn't exist. Defaults to /etc/zomdb/logs.
+	Dir string
+
+	// MaxSegmentSize is the size a segment may grow to before a new segment
+	// is started. Defaults to 64 MiB.
+	MaxSegmentSize int64
+}
+
+// New opens the log stored on fs with the default options. Segments written
+// by a previous Log are reopened and appended to, otherwise an empty log is
+// created.
 func New(fs afero.Fs) (*Log, error) {
+	return NewWithOptions(fs, LogOptions{})
+}
+
+// NewWithOptions is like New but configures the log with opts.
+func NewWithOptions(fs afero.Fs, opts LogOptions) (*Log, error) {
+	if opts.Dir == "" {
+		opts.Dir = defaultLogDir
+	}
+
+	if opts.MaxSegmentSize <= 0 {
+		opts.MaxSegmentSize = defaultMaxSegmentSize
+	}
+
+	if err := fs.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("create dir: %w", err)
+	}
+
 	l := Log{
-		fs: fs,
+		fs:             fs,
+		dir:            opts.Dir,
+		maxSegmentSize: opts.MaxSegmentSize,
+	}
+
+	if err := l.load(); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("load: %w", err)
 	}
 
-	if err := l.rotate(); err != nil {
-		return nil, fmt.Errorf("initial rotate: %w", err)
+	if len(l.segments) == 0 {
+		if err := l.rotate(); err != nil {
+			return nil, fmt.Errorf("initial rotate: %w", err)
+		}
 	}
 
 	return &l, nil
 }
 
+// load opens all existing segments of the log directory.
+func (l *Log) load() error {
+	infos, err := afero.ReadDir(l.fs, l.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("read dir: %w", err)
+	}
+
+	// Segment names sort in the order of the segments.
+	for _, info := range infos {
+		// Skips leftover temporary files of an interrupted compaction.
+		if filepath.Ext(info.Name()) != ".log" {
+			continue
+		}
+
+		var startOff int64
+		if _, err := fmt.Sscanf(info.Name(), "%020d.log", &startOff); err != nil {
+			continue
+		}
+
+		f, err := l.fs.OpenFile(l.filename(startOff), os.O_RDWR|os.O_APPEND, 0655)
+		if err != nil {
+			return fmt.Errorf("open segment: %w", err)
+		}
+
+		l.segments = append(l.segments, segment{startOff: startOff, file: f})
+		l.size = startOff + info.Size()
+	}
+
+	return nil
+}
+
 func (l *Log) ReadAt(b []byte, off int64) (int, error) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
 	if len(l.segments) == 0 {
 		return 0, errNoNew
 	}
@@ -77,22 +181,62 @@ func (l *Log) ReadAt(b []byte, off int64) (int, error) {
 		return 0, fmt.Errorf("seek segment: %w", err)
 	}
 
-	segmentOff := off - l.segments[idx].startOff
+	// The read may span multiple segments, read from each of them until b
+	// is filled.
+	var n int
+	for ; n < len(b); idx++ {
+		if idx == len(l.segments) {
+			return n, io.EOF
+		}
+
+		pos := off + int64(n)
+		s := l.segments[idx]
 
-	n, err := l.segments[idx].file.ReadAt(b, segmentOff)
-	if err != nil {
-		return n, fmt.Errorf("readAt latest segment: %w", err)
+		// Don't read past the end of this segment
+		p := b[n:]
+		if remaining := l.segmentEnd(idx) - pos; int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+
+		m, err := s.file.ReadAt(p, pos-s.startOff)
+		n += m
+
+		if err != nil && !errors.Is(err, io.EOF) {
+			return n, fmt.Errorf("readAt segment %d: %w", idx, err)
+		}
+
+		if m < len(p) {
+			return n, io.EOF
+		}
 	}
 
 	return n, nil
 }
 
+// segmentEnd returns the offset right after the last byte of the segment.
+func (l *Log) segmentEnd(idx int) int64 {
+	if idx == len(l.segments)-1 {
+		return l.size
+	}
+
+	return l.segments[idx+1].startOff
+}
+
 func (l *Log) Write(p []byte) (int, error) {
+	l.writeLock.Lock()
+	defer l.writeLock.Unlock()
+
+	return l.write(p)
+}
+
+// write appends p to the current segment. The caller must hold the write
+// lock.
+func (l *Log) write(p []byte) (int, error) {
 	if len(l.segments) == 0 {
 		return 0, errNoNew
 	}
 
-	n, err := l.segments[0].file.Write(p)
+	n, err := l.segments[len(l.segments)-1].file.Write(p)
 	if err != nil {
 		// Return with error without incrementing the offset
 		// this way, the next write will overwrite the corrupted data
@@ -100,7 +244,15 @@ func (l *Log) Write(p []byte) (int, error) {
 		return n, fmt.Errorf("write: %w", err)
 	}
 
+	l.lock.Lock()
 	l.size += int64(n)
+	l.lock.Unlock()
+
+	if l.size-l.segments[len(l.segments)-1].startOff > l.maxSegmentSize {
+		if err := l.rotate(); err != nil {
+			return n, fmt.Errorf("rotate: %w", err)
+		}
+	}
 
 	return n, nil
 }
@@ -108,7 +260,10 @@ func (l *Log) Write(p []byte) (int, error) {
 // Append appends the content to the most recent log file and
 // returns the updated current offset on success.
 func (l *Log) Append(content []byte) (off int64, err error) {
-	n, err := l.Write(content)
+	l.writeLock.Lock()
+	defer l.writeLock.Unlock()
+
+	n, err := l.write(content)
 	if err != nil {
 		return 0, fmt.Errorf("write: %w", err)
 	}
@@ -116,6 +271,254 @@ func (l *Log) Append(content []byte) (off int64, err error) {
 	return l.size - int64(n), nil
 }
 
+// Sync commits the content of the current segment to stable storage. Older
+// segments are synced when they are rotated.
+func (l *Log) Sync() error {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	return l.sync()
+}
+
+// sync commits the content of the current segment. The caller must hold
+// either lock.
+func (l *Log) sync() error {
+	if len(l.segments) == 0 {
+		return errNoNew
+	}
+
+	if err := l.segments[len(l.segments)-1].file.Sync(); err != nil {
+		return fmt.Errorf("sync: %w", err)
+	}
+
+	return nil
+}
+
+const (
+	// recordHeaderSize is the size of the length prefix of each record.
+	recordHeaderSize = 4
+	// recordTrailerSize is the size of the CRC32 checksum following the
+	// data of each record.
+	recordTrailerSize = 4
+)
+
+// AppendRecord appends the data as a single record, prefixed by its length
+// and followed by its CRC32 checksum, and returns the record's offset.
+//
+// Records can be read back with ReadRecord without knowing their length.
+func (l *Log) AppendRecord(data []byte) (off int64, err error) {
+	if uint64(len(data)) > math.MaxUint32 {
+		return 0, fmt.Errorf("record too large: %d bytes", len(data))
+	}
+
+	record := make([]byte, recordHeaderSize+len(data)+recordTrailerSize)
+	binary.BigEndian.PutUint32(record[:recordHeaderSize], uint32(len(data)))
+	copy(record[recordHeaderSize:], data)
+	binary.BigEndian.PutUint32(record[recordHeaderSize+len(data):], crc32.ChecksumIEEE(data))
+
+	return l.Append(record)
+}
+
+// ReadRecord reads the record starting at off and returns its data together
+// with the offset of the next record.
+//
+// It returns io.EOF if off is the end of the log, and io.ErrUnexpectedEOF if
+// the log ends within the record. If the record doesn't match its checksum,
+// it returns ErrCorruptRecord together with the offset of the next record.
+//
+// The length prefix isn't trusted before the checksum is verified. A length
+// that reaches past the end of the log may as well be garbage, so the error
+// for it matches both io.ErrUnexpectedEOF and ErrCorruptRecord.
+func (l *Log) ReadRecord(off int64) (data []byte, next int64, err error) {
+	size := l.currentSize()
+	if off == size {
+		return nil, 0, io.EOF
+	}
+
+	header := make([]byte, recordHeaderSize)
+	if _, err := l.ReadAt(header, off); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return nil, 0, fmt.Errorf("read header: %w", err)
+	}
+
+	dataSize := binary.BigEndian.Uint32(header)
+	if remaining := size - off - recordHeaderSize; int64(dataSize)+recordTrailerSize > remaining {
+		return nil, 0, fmt.Errorf("record at offset %d: size %d exceeds the log: %w: %w", off, dataSize, ErrCorruptRecord, io.ErrUnexpectedEOF)
+	}
+
+	buf := make([]byte, int64(dataSize)+recordTrailerSize)
+	if _, err := l.ReadAt(buf, off+recordHeaderSize); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return nil, 0, fmt.Errorf("read data: %w", err)
+	}
+
+	data, trailer := buf[:dataSize], buf[dataSize:]
+	next = off + recordHeaderSize + int64(len(buf))
+
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(trailer) {
+		return nil, next, fmt.Errorf("record at offset %d: %w", off, ErrCorruptRecord)
+	}
+
+	return data, next, nil
+}
+
+// Entries returns an iterator over all records from off to the end of the
+// log. It yields each record's offset together with its data. It is the
+// primary way of replaying the log.
+//
+// The returned function reports the error that stopped the iteration, if
+// any. Each call to Entries tracks its own error, so concurrent replays
+// don't see each other's errors:
+//
+//	records, errFn := l.Entries(0)
+//	for off, data := range records {
+//		...
+//	}
+//	if err := errFn(); err != nil {
+//		...
+//	}
+//
+// If the log ends within a record, e.g. because the process crashed while
+// appending it, the iteration stops with io.ErrUnexpectedEOF. The same
+// applies to a last record that doesn't match its checksum, since its write
+// may not have completed. A corrupt record anywhere else stops the
+// iteration with ErrCorruptRecord.
+func (l *Log) Entries(off int64) (iter.Seq2[int64, []byte], func() error) {
+	var iterErr error
+
+	records := func(yield func(int64, []byte) bool) {
+		iterErr = nil
+
+		for off := off; ; {
+			data, next, err := l.ReadRecord(off)
+			if errors.Is(err, io.EOF) {
+				return
+			}
+
+			if errors.Is(err, ErrCorruptRecord) && next == l.currentSize() {
+				iterErr = fmt.Errorf("torn last record: %w", io.ErrUnexpectedEOF)
+				return
+			}
+
+			if err != nil {
+				iterErr = err
+				return
+			}
+
+			if !yield(off, data) {
+				return
+			}
+
+			off = next
+		}
+	}
+
+	return records, func() error { return iterErr }
+}
+
+// ReplayFrom is an alias for Entries.
+//
+// Deprecated: Use Entries instead.
+func (l *Log) ReplayFrom(off int64) (iter.Seq2[int64, []byte], func() error) {
+	return l.Entries(off)
+}
+
+// Truncate removes all records from the log. Offsets start at 0 again
+// afterwards.
+func (l *Log) Truncate() error {
+	l.writeLock.Lock()
+	defer l.writeLock.Unlock()
+
+	if len(l.segments) == 0 {
+		return errNoNew
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for _, s := range l.segments {
+		if err := s.file.Close(); err != nil {
+			return fmt.Errorf("close segment: %w", err)
+		}
+
+		if err := l.fs.Remove(s.file.Name()); err != nil {
+			return fmt.Errorf("remove segment: %w", err)
+		}
+	}
+
+	l.segments = nil
+	l.size = 0
+
+	seg, err := l.newSegment()
+	if err != nil {
+		return fmt.Errorf("rotate: %w", err)
+	}
+
+	l.segments = append(l.segments, seg)
+
+	return nil
+}
+
+// TruncateAt removes everything from offset off onward, e.g. a torn last
+// record. Records before off and their offsets are left untouched.
+func (l *Log) TruncateAt(off int64) error {
+	l.writeLock.Lock()
+	defer l.writeLock.Unlock()
+
+	if len(l.segments) == 0 {
+		return errNoNew
+	}
+
+	if off < 0 || off > l.size {
+		return fmt.Errorf("offset %d out of range [0, %d]", off, l.size)
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	idx, err := seekSegment(l.segments, off)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range l.segments[idx+1:] {
+		if err := s.file.Close(); err != nil {
+			return fmt.Errorf("close segment: %w", err)
+		}
+
+		if err := l.fs.Remove(s.file.Name()); err != nil {
+			return fmt.Errorf("remove segment: %w", err)
+		}
+	}
+
+	l.segments = l.segments[:idx+1]
+
+	s := l.segments[idx]
+	if err := s.file.Truncate(off - s.startOff); err != nil {
+		return fmt.Errorf("truncate segment: %w", err)
+	}
+
+	// Not every afero.File appends at the current end of the file, move
+	// the write position explicitly.
+	if _, err := s.file.Seek(off-s.startOff, io.SeekStart); err != nil {
+		return fmt.Errorf("seek segment: %w", err)
+	}
+
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("sync segment: %w", err)
+	}
+
+	l.size = off
+
+	return nil
+}
+
 func (l *Log) Close() error {
 	var lastErr error
 
@@ -128,52 +531,125 @@ func (l *Log) Close() error {
 	return lastErr
 }
 
-// // Compact should leave files of a certain maxSize
-// func (l *Log) Compact() error {
-// 	if len(l.segments) <= 1 {
-// 		// Current segment is still in use
-// 		return nil
-// 	}
-
-// 	// Compact individual segments
-// 	for i, segment := range l.segments[1:] {
-// 		compacted, err := l.compact(segment.file)
-// 		if err != nil {
-// 			return fmt.Errorf("compact segment %s: %w", segment.file.Name(), err)
-// 		}
-
-// 		name := filename(time.Now())
-
-// 		f, err := l.fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0655)
-// 		if err != nil {
-// 			return fmt.Errorf("open new file: %w", err)
-// 		}
-
-// 		// update offsets
-// 		l.lock.Lock()
-// 		l.segments = append(l.segments[:i], segment{
-// 			segment.startOff,
-// 			file: f,
-// 		})
-// 	}
-// 	return nil
-// }
+// Compact merges the keep oldest segments into a single segment that starts
+// at the offset of the first one. The current segment is never merged, keep
+// is capped accordingly.
+//
+// The merged segment is written to a temporary file that is renamed over the
+// first segment once it is complete. Until the remaining segments are
+// removed, they hold the same bytes at the same offsets as the merged one,
+// so the log stays intact if the process crashes in between.
+func (l *Log) Compact(keep int) error {
+	l.writeLock.Lock()
+	defer l.writeLock.Unlock()
+
+	if len(l.segments) == 0 {
+		return errNoNew
+	}
+
+	keep = min(keep, len(l.segments)-1)
+	if keep < 2 {
+		return nil
+	}
+
+	old := l.segments[:keep]
+	name := l.filename(old[0].startOff)
+	tmp := name + ".tmp"
+
+	f, err := l.fs.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0655)
+	if err != nil {
+		return fmt.Errorf("open temp file: %w", err)
+	}
+
+	for i, s := range old {
+		r := io.NewSectionReader(s.file, 0, l.segmentEnd(i)-s.startOff)
+		if _, err := io.Copy(f, r); err != nil {
+			f.Close()
+			return fmt.Errorf("copy segment %d: %w", i, err)
+		}
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("sync: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close temp file: %w", err)
+	}
+
+	if err := l.fs.Rename(tmp, name); err != nil {
+		return fmt.Errorf("rename: %w", err)
+	}
+
+	merged, err := l.fs.OpenFile(name, os.O_RDWR|os.O_APPEND, 0655)
+	if err != nil {
+		return fmt.Errorf("open merged segment: %w", err)
+	}
+
+	// Swap in the merged segment at once, so that readers never see a gap.
+	l.lock.Lock()
+	l.segments = append([]segment{{startOff: old[0].startOff, file: merged}}, l.segments[keep:]...)
+	l.lock.Unlock()
 
+	for i, s := range old {
+		if err := s.file.Close(); err != nil {
+			return fmt.Errorf("close segment: %w", err)
+		}
+
+		// The first segment was replaced by the rename.
+		if i == 0 {
+			continue
+		}
+
+		if err := l.fs.Remove(s.file.Name()); err != nil {
+			return fmt.Errorf("remove segment: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// rotate starts a new segment. The caller must hold the write lock.
 func (l *Log) rotate() error {
-	name := filename(time.Now())
+	s, err := l.newSegment()
+	if err != nil {
+		return err
+	}
+
+	l.lock.Lock()
+	l.segments = append(l.segments, s)
+	l.lock.Unlock()
+
+	return nil
+}
+
+// newSegment syncs the current segment and creates the segment following
+// it. The caller must hold the write lock.
+func (l *Log) newSegment() (segment, error) {
+	if len(l.segments) > 0 {
+		// The current segment won't be written to anymore.
+		if err := l.sync(); err != nil {
+			return segment{}, fmt.Errorf("sync current segment: %w", err)
+		}
+	}
+
+	name := l.filename(l.size)
 
 	f, err := l.fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0655)
 	if err != nil {
-		return fmt.Errorf("open new file: %w", err)
+		return segment{}, fmt.Errorf("open new file: %w", err)
 	}
 
-	// Prepend new segment
-	l.segments = append([]segment{{
-		startOff: l.size,
-		file:     f,
-	}}, l.segments...)
+	return segment{startOff: l.size, file: f}, nil
+}
 
-	return nil
+// currentSize returns the offset right after the last byte of the log.
+func (l *Log) currentSize() int64 {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	return l.size
 }
 
 func seekSegment(segments []segment, off int64) (idx int, err error) {
@@ -197,8 +673,10 @@ func seekSegment(segments []segment, off int64) (idx int, err error) {
 	return idx, nil
 }
 
-func filename(t time.Time) string {
-	file := fmt.Sprintf("%s.log", t.Format(time.RFC3339))
+// filename names segments after their start offset, so that their names
+// sort in the same order as the segments.
+func (l *Log) filename(startOff int64) string {
+	file := fmt.Sprintf("%020d.log", startOff)
 
-	return filepath.Join(defaultLogDir, file)
+	return filepath.Join(l.dir, file)
 }
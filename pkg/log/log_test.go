@@ -1,6 +1,11 @@
 package log
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/spf13/afero"
@@ -51,3 +56,707 @@ func TestLog(t *testing.T) {
 		t.Fatalf("expected %s, got %s", row2, buf2)
 	}
 }
+
+func TestLogReadOldSegment(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+
+	log, err := New(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row1 := "first segment"
+	row2 := "second segment"
+
+	offset1, err := log.Append([]byte(row1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := log.rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	offset2, err := log.Append([]byte(row2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf1 := make([]byte, len(row1))
+	if _, err := log.ReadAt(buf1, offset1); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(buf1) != row1 {
+		t.Fatalf("expected %s, got %s", row1, buf1)
+	}
+
+	buf2 := make([]byte, len(row2))
+	if _, err := log.ReadAt(buf2, offset2); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(buf2) != row2 {
+		t.Fatalf("expected %s, got %s", row2, buf2)
+	}
+}
+
+func TestLogReadAcrossSegments(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+
+	log, err := New(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, part := range []string{"hallo ", "ballo ", "lullu"} {
+		if _, err := log.Append([]byte(part)); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := log.rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := make([]byte, 14)
+	n, err := log.ReadAt(buf, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "lo ballo lullu"; string(buf[:n]) != want {
+		t.Fatalf("expected %q, got %q", want, buf[:n])
+	}
+
+	buf = make([]byte, 10)
+	n, err = log.ReadAt(buf, 12)
+	if !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+
+	if want := "lullu"; string(buf[:n]) != want {
+		t.Fatalf("expected %q, got %q", want, buf[:n])
+	}
+}
+
+func TestLogSync(t *testing.T) {
+	t.Parallel()
+
+	log, err := New(afero.NewMemMapFs())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := log.Append([]byte("hallo")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := log.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&Log{}).Sync(); err == nil {
+		t.Fatal("expected error for log without segments")
+	}
+}
+
+func TestLogRecords(t *testing.T) {
+	t.Parallel()
+
+	log, err := New(afero.NewMemMapFs())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := []string{"hallo ballo", "", "lullu schlullu"}
+
+	var offsets []int64
+	for _, record := range records {
+		off, err := log.AppendRecord([]byte(record))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		offsets = append(offsets, off)
+	}
+
+	off := offsets[0]
+	for i, record := range records {
+		if off != offsets[i] {
+			t.Fatalf("record %d: expected offset %d, got %d", i, offsets[i], off)
+		}
+
+		data, next, err := log.ReadRecord(off)
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+
+		if string(data) != record {
+			t.Fatalf("record %d: expected %q, got %q", i, record, data)
+		}
+
+		off = next
+	}
+
+	if _, _, err := log.ReadRecord(off); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+
+	// A partially written record
+	if _, err := log.Append([]byte{0, 0, 0, 10, 'a'}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := log.ReadRecord(off); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestLogRecordSize(t *testing.T) {
+	t.Parallel()
+
+	log, err := New(afero.NewMemMapFs())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A garbled length prefix claiming a 4 GiB record
+	if _, err := log.Append([]byte{0xFF, 0xFF, 0xFF, 0xFF, 'a', 0, 0, 0, 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = log.ReadRecord(0)
+	if !errors.Is(err, ErrCorruptRecord) {
+		t.Fatalf("expected ErrCorruptRecord, got %v", err)
+	}
+
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestLogReplayFrom(t *testing.T) {
+	t.Parallel()
+
+	log, err := New(afero.NewMemMapFs())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var checkpoint int64
+	for i, record := range []string{"one", "two", "three"} {
+		off, err := log.AppendRecord([]byte(record))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if i == 1 {
+			checkpoint = off
+		}
+	}
+
+	var replayed []string
+	records, errFn := log.ReplayFrom(checkpoint)
+	for _, data := range records {
+		replayed = append(replayed, string(data))
+	}
+
+	if err := errFn(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(replayed) != 2 || replayed[0] != "two" || replayed[1] != "three" {
+		t.Fatalf("expected [two three], got %v", replayed)
+	}
+
+	// A partially written record
+	if _, err := log.Append([]byte{0, 0, 0, 10, 'a'}); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed = nil
+	records, errFn = log.ReplayFrom(checkpoint)
+	for _, data := range records {
+		replayed = append(replayed, string(data))
+	}
+
+	if !errors.Is(errFn(), io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", errFn())
+	}
+
+	if len(replayed) != 2 {
+		t.Fatalf("expected 2 complete records, got %v", replayed)
+	}
+}
+
+func TestLogEntries(t *testing.T) {
+	t.Parallel()
+
+	log, err := New(afero.NewMemMapFs())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := log.AppendRecord([]byte("one")); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	records, errFn := log.Entries(0)
+	for range records {
+		n++
+	}
+
+	if err := errFn(); err != nil || n != 1 {
+		t.Fatalf("expected a single record and no error, got %d, %v", n, err)
+	}
+
+	// A record with a wrong checksum that isn't the last one
+	if _, err := log.Append([]byte{0, 0, 0, 1, 'x', 0, 0, 0, 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	three, err := log.AppendRecord([]byte("three"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n = 0
+	records, errFn = log.Entries(0)
+	for range records {
+		n++
+	}
+
+	if !errors.Is(errFn(), ErrCorruptRecord) {
+		t.Fatalf("expected ErrCorruptRecord, got %v", errFn())
+	}
+
+	if n != 1 {
+		t.Fatalf("expected iteration to stop at the corrupt record, got %d records", n)
+	}
+
+	// Concurrent replays only see their own errors.
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			off := int64(0)
+			if i%2 == 0 {
+				off = three
+			}
+
+			records, errFn := log.Entries(off)
+			for range records {
+			}
+
+			err := errFn()
+			if off == three && err != nil {
+				t.Errorf("replay from %d: expected no error, got %v", off, err)
+			}
+
+			if off == 0 && !errors.Is(err, ErrCorruptRecord) {
+				t.Errorf("replay from %d: expected ErrCorruptRecord, got %v", off, err)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestLogRotateBySize(t *testing.T) {
+	t.Parallel()
+
+	log, err := NewWithOptions(afero.NewMemMapFs(), LogOptions{MaxSegmentSize: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, part := range []string{"hallo ", "ballo ", "lullu"} {
+		if _, err := log.Append([]byte(part)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(log.segments) != 2 {
+		t.Fatalf("expected 2 segments, got %d", len(log.segments))
+	}
+
+	if s := log.segments[1]; s.startOff != 12 {
+		t.Fatalf("expected new segment to start at 12, got %d", s.startOff)
+	}
+
+	buf := make([]byte, 17)
+	if _, err := log.ReadAt(buf, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "hallo ballo lullu"; string(buf) != want {
+		t.Fatalf("expected %q, got %q", want, buf)
+	}
+}
+
+func TestLogRecordChecksum(t *testing.T) {
+	t.Parallel()
+
+	log, err := New(afero.NewMemMapFs())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := log.AppendRecord([]byte("one")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A record with a wrong checksum
+	corrupt, err := log.Append([]byte{0, 0, 0, 1, 'a', 0, 0, 0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := log.ReadRecord(corrupt); !errors.Is(err, ErrCorruptRecord) {
+		t.Fatalf("expected ErrCorruptRecord, got %v", err)
+	}
+
+	// The last record may have been torn while writing
+	records, errFn := log.ReplayFrom(0)
+	for range records {
+	}
+
+	if !errors.Is(errFn(), io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", errFn())
+	}
+
+	if _, err := log.AppendRecord([]byte("two")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Now it's followed by another record
+	var replayed []string
+	records, errFn = log.ReplayFrom(0)
+	for _, data := range records {
+		replayed = append(replayed, string(data))
+	}
+
+	if !errors.Is(errFn(), ErrCorruptRecord) {
+		t.Fatalf("expected ErrCorruptRecord, got %v", errFn())
+	}
+
+	if len(replayed) != 1 || replayed[0] != "one" {
+		t.Fatalf("expected [one], got %v", replayed)
+	}
+}
+
+func TestLogReopen(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+
+	log, err := NewWithOptions(fs, LogOptions{MaxSegmentSize: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range []string{"one", "two", "three"} {
+		if _, err := log.AppendRecord([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	log, err = NewWithOptions(fs, LogOptions{MaxSegmentSize: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := log.AppendRecord([]byte("four")); err != nil {
+		t.Fatal(err)
+	}
+
+	var replayed []string
+	records, errFn := log.ReplayFrom(0)
+	for _, data := range records {
+		replayed = append(replayed, string(data))
+	}
+
+	if err := errFn(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(replayed) != 4 || replayed[0] != "one" || replayed[3] != "four" {
+		t.Fatalf("expected all 4 records, got %v", replayed)
+	}
+}
+
+func TestLogTruncate(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+
+	log, err := NewWithOptions(fs, LogOptions{MaxSegmentSize: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range []string{"one", "two"} {
+		if _, err := log.AppendRecord([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := log.Truncate(); err != nil {
+		t.Fatal(err)
+	}
+
+	off, err := log.AppendRecord([]byte("three"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if off != 0 {
+		t.Fatalf("expected offsets to start at 0, got %d", off)
+	}
+
+	files, err := afero.ReadDir(fs, defaultLogDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 {
+		t.Fatalf("expected a single segment, got %d", len(files))
+	}
+}
+
+func TestLogTruncateAt(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+
+	log, err := NewWithOptions(fs, LogOptions{MaxSegmentSize: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var offs []int64
+	for _, data := range []string{"one", "two", "three"} {
+		off, err := log.AppendRecord([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		offs = append(offs, off)
+	}
+
+	if err := log.TruncateAt(offs[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	records, errFn := log.Entries(0)
+	for _, data := range records {
+		got = append(got, string(data))
+	}
+
+	if err := errFn(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 1 || got[0] != "one" {
+		t.Fatalf("expected only the first record, got %q", got)
+	}
+
+	off, err := log.AppendRecord([]byte("four"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if off != offs[1] {
+		t.Fatalf("expected next record at offset %d, got %d", offs[1], off)
+	}
+
+	if err := log.TruncateAt(off + 100); err == nil {
+		t.Fatal("expected error for offset beyond the end")
+	}
+}
+
+func TestLogCompact(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+
+	log, err := NewWithOptions(fs, LogOptions{MaxSegmentSize: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := []string{"one", "two", "three", "four"}
+	var offsets []int64
+	for _, data := range records {
+		off, err := log.AppendRecord([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		offsets = append(offsets, off)
+	}
+
+	// Each record ends up in its own segment, followed by the empty
+	// current one.
+	if len(log.segments) != 5 {
+		t.Fatalf("expected 5 segments, got %d", len(log.segments))
+	}
+
+	if err := log.Compact(3); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(log.segments) != 3 {
+		t.Fatalf("expected 3 segments after compaction, got %d", len(log.segments))
+	}
+
+	check := func(log *Log) {
+		t.Helper()
+
+		for i, off := range offsets {
+			data, _, err := log.ReadRecord(off)
+			if err != nil {
+				t.Fatalf("read record %d: %v", i, err)
+			}
+
+			if string(data) != records[i] {
+				t.Fatalf("expected %q, got %q", records[i], data)
+			}
+		}
+	}
+
+	check(log)
+
+	files, err := afero.ReadDir(fs, defaultLogDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 3 {
+		t.Fatalf("expected merged segments to be removed, got %d files", len(files))
+	}
+
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewWithOptions(fs, LogOptions{MaxSegmentSize: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check(reopened)
+}
+
+func TestLogConcurrentAppend(t *testing.T) {
+	t.Parallel()
+
+	log, err := NewWithOptions(afero.NewMemMapFs(), LogOptions{MaxSegmentSize: 256})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < 100; i++ {
+				data := []byte(fmt.Sprintf("record_%d_%d", g, i))
+
+				off, err := log.AppendRecord(data)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				// Records can be read back while others are written.
+				read, _, err := log.ReadRecord(off)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				if string(read) != string(data) {
+					t.Errorf("expected %q at offset %d, got %q", data, off, read)
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	var n int
+	records, errFn := log.ReplayFrom(0)
+	for range records {
+		n++
+	}
+
+	if err := errFn(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 400 {
+		t.Fatalf("expected 400 records, got %d", n)
+	}
+}
+
+func TestLogDir(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+
+	// Logs in different directories don't see each other's segments.
+	for _, dir := range []string{"a", "b"} {
+		log, err := NewWithOptions(fs, LogOptions{Dir: dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := log.AppendRecord([]byte(dir)); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := log.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	log, err := NewWithOptions(fs, LogOptions{Dir: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var replayed []string
+	records, errFn := log.Entries(0)
+	for _, data := range records {
+		replayed = append(replayed, string(data))
+	}
+
+	if err := errFn(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(replayed) != 1 || replayed[0] != "b" {
+		t.Fatalf("expected [b], got %v", replayed)
+	}
+
+	if _, err := fs.Stat(filepath.Join("a", "00000000000000000000.log")); err != nil {
+		t.Fatalf("expected segment in dir a: %v", err)
+	}
+}
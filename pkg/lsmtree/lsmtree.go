@@ -1,7 +1,13 @@
 package lsmtree
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"math"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/DerGut/zomdb/pkg/memtable"
@@ -9,28 +15,470 @@ import (
 	"github.com/spf13/afero"
 )
 
+const (
+	defaultMaxMemBytes     = 4 << 20 // 4 MiB
+	defaultMaxSSTables     = 4
+	defaultBaseLevelBytes  = 10 << 20 // 10 MiB
+	defaultLevelMultiplier = 10
+)
+
+var ErrNotFound = errors.New("not found")
+
 type LSMTree struct {
 	fs      afero.Fs
 	timeSrc func() time.Time
+
+	manager *sstable.SSTableManager
+
+	// lock guards the memtable and levels fields. Writers hold it while
+	// flushing or swapping in compacted tables so that readers never
+	// observe data in neither place.
+	lock sync.RWMutex
+
+	memtable *memtable.MemTable
+	// levels holds the SSTables of each level, ordered from oldest to
+	// newest. Flushed memtables end up in level 0, compaction moves data
+	// to the following levels. Each level only holds data that is older
+	// than that of the levels before it. Only the tables of level 0 may
+	// have overlapping key ranges.
+	levels [][]*sstable.SSTable
+	// createdAt holds the creation time of each SSTable for the manifest.
+	createdAt map[*sstable.SSTable]time.Time
+
+	maxMemBytes     int64
+	maxSSTables     int
+	baseLevelBytes  int64
+	levelMultiplier int64
+
+	// compactLock makes sure that only one compaction runs at a time.
+	compactLock sync.Mutex
+	// flushed is notified after each flush to trigger the background
+	// compaction.
+	flushed chan struct{}
+	stop    context.CancelFunc
+	wg      sync.WaitGroup
 }
 
-func (t *LSMTree) Compact(sst *sstable.SSTable) (*sstable.SSTable, error) {
-	return nil, nil
+type Options struct {
+	// MaxMemBytes is the size the memtable may grow to before it is
+	// flushed to a new SSTable. Defaults to 4 MiB.
+	MaxMemBytes int64
+
+	// MaxSSTables is the number of SSTables level 0 may hold before they
+	// are compacted into level 1. Defaults to 4.
+	MaxSSTables int
+
+	// BaseLevelBytes and LevelMultiplier limit the total size of the
+	// SSTables of each level but level 0. Level n may hold
+	// BaseLevelBytes * LevelMultiplier^n bytes before it is compacted into
+	// level n+1. They default to 10 MiB and 10.
+	BaseLevelBytes  int64
+	LevelMultiplier int64
+}
+
+func New(fs afero.Fs, opts Options) *LSMTree {
+	if opts.MaxMemBytes <= 0 {
+		opts.MaxMemBytes = defaultMaxMemBytes
+	}
+
+	if opts.MaxSSTables <= 0 {
+		opts.MaxSSTables = defaultMaxSSTables
+	}
+
+	if opts.BaseLevelBytes <= 0 {
+		opts.BaseLevelBytes = defaultBaseLevelBytes
+	}
+
+	if opts.LevelMultiplier <= 0 {
+		opts.LevelMultiplier = defaultLevelMultiplier
+	}
+
+	timeSrc := time.Now
+
+	return &LSMTree{
+		fs:              fs,
+		timeSrc:         timeSrc,
+		manager:         sstable.NewSSTableManager(fs, sstable.SSTableManagerOptions{TimeSrc: timeSrc}),
+		memtable:        &memtable.MemTable{},
+		levels:          make([][]*sstable.SSTable, 1),
+		createdAt:       make(map[*sstable.SSTable]time.Time),
+		maxMemBytes:     opts.MaxMemBytes,
+		maxSSTables:     opts.MaxSSTables,
+		baseLevelBytes:  opts.BaseLevelBytes,
+		levelMultiplier: opts.LevelMultiplier,
+		flushed:         make(chan struct{}, 1),
+	}
+}
+
+// Start launches a goroutine that compacts levels in the background,
+// whenever they exceed their limit. It runs until ctx is
+// cancelled or the tree is closed.
+func (t *LSMTree) Start(ctx context.Context) {
+	ctx, t.stop = context.WithCancel(ctx)
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.flushed:
+			}
+
+			// TODO: report errors
+			_ = t.compactAll()
+		}
+	}()
+}
+
+// Close stops the background compaction, waits for an ongoing compaction
+// to finish and closes all SSTables. The tree must not be used afterwards.
+func (t *LSMTree) Close() error {
+	if t.stop != nil {
+		t.stop()
+	}
+
+	t.wg.Wait()
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var errs []error
+	for _, level := range t.levels {
+		for _, sst := range level {
+			if err := sst.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("close sstable: %w", err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Put writes the key-value pair to the memtable. Once the memtable exceeds
+// its maximum size, it is flushed to a new SSTable.
+func (t *LSMTree) Put(key, value []byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if err := t.memtable.Put(key, value); err != nil {
+		return fmt.Errorf("memtable put: %w", err)
+	}
+
+	if t.memtable.Exceeds(t.maxMemBytes) {
+		if err := t.flush(); err != nil {
+			return fmt.Errorf("flush: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Delete writes a tombstone for key to the memtable. It shadows older
+// values of the key until compaction into the deepest level drops both.
+func (t *LSMTree) Delete(key []byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if err := t.memtable.Delete(key); err != nil {
+		return fmt.Errorf("memtable delete: %w", err)
+	}
+
+	if t.memtable.Exceeds(t.maxMemBytes) {
+		if err := t.flush(); err != nil {
+			return fmt.Errorf("flush: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Get looks up the most recent value for key. It checks the memtable first
+// and then all SSTables from newest to oldest.
+//
+// Each SSTable consults its bloom filter before reading from disk.
+func (t *LSMTree) Get(ctx context.Context, key []byte) ([]byte, error) {
+	return t.GetAt(ctx, key, math.MaxUint64)
+}
+
+// Seq returns the sequence number of the latest write. Passing it to GetAt
+// reads the tree as of now, ignoring later writes.
+func (t *LSMTree) Seq() uint64 {
+	return t.memtable.Seq()
+}
+
+// GetAt is like Get but returns the value of key as of sequence number
+// seq, ignoring later writes.
+//
+// Older versions are only kept until they are overwritten in the memtable
+// or compacted away, so GetAt may return ErrNotFound for a key that had a
+// value at seq.
+func (t *LSMTree) GetAt(ctx context.Context, key []byte, seq uint64) ([]byte, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if value, deleted, found := t.memtable.LookupAt(key, seq); found {
+		if deleted {
+			// The tombstone shadows older values in the SSTables.
+			return nil, ErrNotFound
+		}
+
+		return value, nil
+	}
+
+	for _, level := range t.levels {
+		for i := len(level) - 1; i >= 0; i-- {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			// Cheap pre-filter that doesn't need to read the file.
+			if !level[i].Meta().Contains(key) {
+				continue
+			}
+
+			value, err := level[i].GetAt(key, seq)
+			switch {
+			case err == nil:
+				return value, nil
+			case errors.Is(err, sstable.ErrDeleted):
+				return nil, ErrNotFound
+			case errors.Is(err, sstable.ErrNotFound):
+				continue
+			default:
+				return nil, fmt.Errorf("sstable get: %w", err)
+			}
+		}
+	}
+
+	return nil, ErrNotFound
 }
 
-func do() error {
-	mem := memtable.MemTable{}
-	sst, err := sstable.FromMemtable(&mem)
+// flush writes the memtable to a new SSTable and clears it. The caller must hold the write lock.
+func (t *LSMTree) flush() error {
+	sst, err := t.manager.FromMemtable(t.memtable)
 	if err != nil {
 		return fmt.Errorf("from memtable: %w", err)
 	}
 
-	nsst, err := sst.Compact()
-	if err != nil {
-		return fmt.Errorf("compact: %w", err)
+	t.levels[0] = append(t.levels[0], sst)
+	t.createdAt[sst] = t.timeSrc()
+	t.memtable.Clear()
+
+	if err := t.writeManifest(); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+
+	select {
+	case t.flushed <- struct{}{}:
+	default:
+		// A compaction is already pending.
 	}
 
-	fmt.Println(nsst)
+	return nil
+}
+
+// Compact compacts the level into the next one if it exceeds its limit
+// (leveled compaction).
+//
+// Level 0 holds flushed memtables, whose key ranges may overlap. Once it
+// holds more than MaxSSTables tables, all of them are merged with the
+// overlapping tables of level 1. Any other level is compacted once its
+// tables exceed its size limit, by merging its oldest table with the
+// overlapping tables of the next level.
+func (t *LSMTree) Compact(level int) error {
+	t.compactLock.Lock()
+	defer t.compactLock.Unlock()
+
+	if _, err := t.compactLevel(level); err != nil {
+		return fmt.Errorf("compact level %d: %w", level, err)
+	}
 
 	return nil
 }
+
+// compactAll compacts all levels, from the top down, until none exceeds its
+// limit.
+func (t *LSMTree) compactAll() error {
+	t.compactLock.Lock()
+	defer t.compactLock.Unlock()
+
+	for level := 0; ; {
+		t.lock.RLock()
+		n := len(t.levels)
+		t.lock.RUnlock()
+
+		if level >= n {
+			return nil
+		}
+
+		compacted, err := t.compactLevel(level)
+		if err != nil {
+			return fmt.Errorf("compact level %d: %w", level, err)
+		}
+
+		if !compacted {
+			level++
+		}
+	}
+}
+
+// compactLevel merges the tables picked from the level with the
+// overlapping tables of the next level into a new table on the next level.
+// It reports whether the level exceeded its limit. The caller must hold the
+// compact lock.
+func (t *LSMTree) compactLevel(level int) (bool, error) {
+	t.lock.RLock()
+	inputs := t.pickInputs(level)
+	if len(inputs) == 0 {
+		t.lock.RUnlock()
+		return false, nil
+	}
+
+	// Merging the inputs yields a table spanning their whole key range,
+	// so it must not overlap any table of the next level that isn't
+	// merged.
+	lo, hi := keyRange(inputs)
+
+	var overlapping []*sstable.SSTable
+	if level+1 < len(t.levels) {
+		for _, sst := range t.levels[level+1] {
+			if overlaps(sst.Meta(), lo, hi) {
+				overlapping = append(overlapping, sst)
+			}
+		}
+	}
+
+	// Tombstones can be dropped if there's no older data left that
+	// they'd need to shadow.
+	final := true
+	if level+2 < len(t.levels) {
+		for _, deeper := range t.levels[level+2:] {
+			if len(deeper) > 0 {
+				final = false
+			}
+		}
+	}
+	t.lock.RUnlock()
+
+	// SSTables are immutable, so we can merge them without holding the
+	// lock. Flushes only ever append new tables to level 0, and only
+	// compaction modifies the other levels. Tables of the next level are
+	// older than the inputs.
+	merged, err := t.manager.MergeAll(append(overlapping, inputs...), final)
+	if err != nil {
+		return false, fmt.Errorf("merge: %w", err)
+	}
+
+	t.lock.Lock()
+	t.levels[level] = slices.Delete(t.levels[level], 0, len(inputs))
+	if level+1 == len(t.levels) {
+		t.levels = append(t.levels, nil)
+	}
+	t.levels[level+1] = slices.DeleteFunc(t.levels[level+1], func(sst *sstable.SSTable) bool {
+		return slices.Contains(overlapping, sst)
+	})
+	t.levels[level+1] = append(t.levels[level+1], merged)
+	t.createdAt[merged] = t.timeSrc()
+
+	removed := append(inputs, overlapping...)
+	for _, sst := range removed {
+		delete(t.createdAt, sst)
+	}
+
+	// The old tables are only removed once the manifest no longer lists
+	// them.
+	err = t.writeManifest()
+	t.lock.Unlock()
+
+	if err != nil {
+		return false, fmt.Errorf("write manifest: %w", err)
+	}
+
+	// No reader can still reference the old tables, since readers hold the
+	// read lock during their lookup.
+	for _, sst := range removed {
+		if err := t.manager.Remove(sst); err != nil {
+			return false, fmt.Errorf("remove: %w", err)
+		}
+	}
+
+	return true, nil
+}
+
+// pickInputs returns the tables of the level that should be compacted into
+// the next level, or none if the level doesn't exceed its limit. The picked
+// tables are always the oldest ones of the level. The caller must hold the
+// read lock.
+func (t *LSMTree) pickInputs(level int) []*sstable.SSTable {
+	if level < 0 || level >= len(t.levels) {
+		return nil
+	}
+
+	tables := t.levels[level]
+
+	if level == 0 {
+		if len(tables) <= t.maxSSTables {
+			return nil
+		}
+
+		// The key ranges of level 0 tables overlap, so they all need
+		// to be compacted at once.
+		return slices.Clone(tables)
+	}
+
+	var size int64
+	for _, sst := range tables {
+		size += sst.Size()
+	}
+
+	if size <= t.levelLimit(level) {
+		return nil
+	}
+
+	// The level is modified in place once the compaction is done, so the
+	// tables must be copied.
+	return slices.Clone(tables[:1])
+}
+
+// levelLimit returns the number of bytes the tables of the level may hold,
+// i.e. BaseLevelBytes * LevelMultiplier^level.
+func (t *LSMTree) levelLimit(level int) int64 {
+	limit := t.baseLevelBytes
+	for range level {
+		limit *= t.levelMultiplier
+	}
+
+	return limit
+}
+
+// keyRange returns the smallest and largest key of all tables.
+func keyRange(tables []*sstable.SSTable) (lo, hi []byte) {
+	for _, sst := range tables {
+		meta := sst.Meta()
+		if meta.EntryCount == 0 {
+			continue
+		}
+
+		if lo == nil || bytes.Compare(meta.MinKey, lo) < 0 {
+			lo = meta.MinKey
+		}
+
+		if hi == nil || bytes.Compare(meta.MaxKey, hi) > 0 {
+			hi = meta.MaxKey
+		}
+	}
+
+	return lo, hi
+}
+
+// overlaps reports whether the key range of the table intersects [lo, hi].
+func overlaps(meta sstable.Meta, lo, hi []byte) bool {
+	if meta.EntryCount == 0 || lo == nil {
+		return false
+	}
+
+	return bytes.Compare(meta.MinKey, hi) <= 0 && bytes.Compare(lo, meta.MaxKey) <= 0
+}
@@ -0,0 +1,433 @@
+package lsmtree
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/mem"
+)
+
+func TestPutFlush(t *testing.T) {
+	tree := newTestTree(t, Options{MaxMemBytes: 10})
+
+	if err := tree.Put([]byte("key1"), []byte("val1")); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tree.levels[0]) != 0 {
+		t.Fatalf("expected no flush yet, got %d sstables", len(tree.levels[0]))
+	}
+
+	if err := tree.Put([]byte("key2"), []byte("val2")); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tree.levels[0]) != 1 {
+		t.Fatalf("expected a single flushed sstable, got %d", len(tree.levels[0]))
+	}
+
+	if tree.memtable.ByteSize() != 0 {
+		t.Fatalf("expected empty memtable after flush, got %d bytes", tree.memtable.ByteSize())
+	}
+
+	for _, key := range []string{"key1", "key2"} {
+		value, err := tree.levels[0][0].Get([]byte(key))
+		if err != nil {
+			t.Fatalf("get %s: %v", key, err)
+		}
+
+		if !bytes.Equal(value, []byte("val"+key[3:])) {
+			t.Fatalf("unexpected value for %s: %q", key, value)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	ctx := context.Background()
+	tree := newTestTree(t, Options{MaxMemBytes: 10})
+
+	// The first two writes get flushed, the last one stays in the memtable.
+	for _, kv := range [][2]string{
+		{"key1", "old1"},
+		{"key2", "val2"},
+		{"key1", "new1"},
+	} {
+		if err := tree.Put([]byte(kv[0]), []byte(kv[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for key, want := range map[string]string{"key1": "new1", "key2": "val2"} {
+		value, err := tree.Get(ctx, []byte(key))
+		if err != nil {
+			t.Fatalf("get %s: %v", key, err)
+		}
+
+		if !bytes.Equal(value, []byte(want)) {
+			t.Fatalf("get %s: expected %q, got %q", key, want, value)
+		}
+	}
+
+	if _, err := tree.Get(ctx, []byte("key3")); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if _, err := tree.Get(ctx, []byte("key2")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestGetAt(t *testing.T) {
+	ctx := context.Background()
+	fs := afero.NewMemMapFs()
+	// Flush on every write.
+	opts := Options{MaxMemBytes: 1}
+
+	tree, err := Open(fs, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tree.Put([]byte("a"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	seq := tree.Seq()
+
+	if err := tree.Put([]byte("a"), []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tree.levels[0]) != 2 {
+		t.Fatalf("expected 2 flushed sstables, got %d", len(tree.levels[0]))
+	}
+
+	value, err := tree.GetAt(ctx, []byte("a"), seq)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(value, []byte("1")) {
+		t.Fatalf("expected old value %q, got %q", "1", value)
+	}
+
+	value, err = tree.Get(ctx, []byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(value, []byte("2")) {
+		t.Fatalf("expected new value %q, got %q", "2", value)
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Writes after reopening shadow the flushed ones.
+	reopened, err := Open(fs, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := reopened.Seq(); got != 2 {
+		t.Fatalf("expected seq 2 after reopening, got %d", got)
+	}
+
+	if err := reopened.Put([]byte("a"), []byte("3")); err != nil {
+		t.Fatal(err)
+	}
+
+	value, err = reopened.Get(ctx, []byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(value, []byte("3")) {
+		t.Fatalf("expected value %q after reopening, got %q", "3", value)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	ctx := context.Background()
+	// Flush on every write.
+	tree := newTestTree(t, Options{MaxMemBytes: 1, MaxSSTables: 2})
+
+	for i, kv := range [][2]string{
+		{"a", "1"},
+		{"b", "1"},
+		{"a", "2"},
+		{"c", "1"},
+		{"b", "2"},
+	} {
+		if err := tree.Put([]byte(kv[0]), []byte(kv[1])); err != nil {
+			t.Fatalf("put %d: %v", i, err)
+		}
+	}
+
+	if err := tree.Compact(0); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tree.levels[0]) != 0 {
+		t.Fatalf("expected level 0 to be empty, got %d sstables", len(tree.levels[0]))
+	}
+
+	if len(tree.levels[1]) != 1 {
+		t.Fatalf("expected a single sstable on level 1, got %d", len(tree.levels[1]))
+	}
+
+	for key, want := range map[string]string{"a": "2", "b": "2", "c": "1"} {
+		value, err := tree.Get(ctx, []byte(key))
+		if err != nil {
+			t.Fatalf("get %s: %v", key, err)
+		}
+
+		if !bytes.Equal(value, []byte(want)) {
+			t.Fatalf("get %s: expected %q, got %q", key, want, value)
+		}
+	}
+
+	files, err := afero.ReadDir(tree.fs, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The merged SSTable and the manifest
+	if len(files) != 2 {
+		t.Fatalf("expected compacted files to be removed, got %d files", len(files))
+	}
+}
+
+func TestCompactLeveled(t *testing.T) {
+	ctx := context.Background()
+	// Flush on every write, compact level 0 once it holds two tables and
+	// level 1 once it holds anything.
+	tree := newTestTree(t, Options{MaxMemBytes: 1, MaxSSTables: 1, BaseLevelBytes: 1})
+
+	put := func(kvs ...string) {
+		t.Helper()
+
+		for i := 0; i < len(kvs); i += 2 {
+			if err := tree.Put([]byte(kvs[i]), []byte(kvs[i+1])); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	compact := func(level int) {
+		t.Helper()
+
+		if err := tree.Compact(level); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expectTables := func(want ...int) {
+		t.Helper()
+
+		for level, n := range want {
+			if got := len(tree.levels[level]); got != n {
+				t.Fatalf("level %d: expected %d sstables, got %d", level, n, got)
+			}
+		}
+	}
+
+	put("ka", "1", "kb", "1")
+	compact(0)
+	put("kc", "1", "kd", "1")
+	compact(0)
+	// Neither table overlaps the other.
+	expectTables(0, 2)
+
+	// Only the oldest table of level 1 moves down.
+	compact(1)
+	expectTables(0, 1, 1)
+
+	// Level 0 spans both tables of level 1, even though it doesn't hold
+	// all of their keys.
+	put("ka", "2", "kz", "1")
+	compact(0)
+	expectTables(0, 1, 1)
+
+	if n := tree.levels[1][0].Meta().EntryCount; n != 4 {
+		t.Fatalf("expected level 1 to hold 4 entries, got %d", n)
+	}
+
+	compact(1)
+	expectTables(0, 0, 1)
+
+	for key, want := range map[string]string{"ka": "2", "kb": "1", "kc": "1", "kd": "1", "kz": "1"} {
+		value, err := tree.Get(ctx, []byte(key))
+		if err != nil {
+			t.Fatalf("get %s: %v", key, err)
+		}
+
+		if !bytes.Equal(value, []byte(want)) {
+			t.Fatalf("get %s: expected %q, got %q", key, want, value)
+		}
+	}
+
+	// BaseLevelBytes * LevelMultiplier^3
+	if limit := tree.levelLimit(3); limit != 1000 {
+		t.Fatalf("expected level 3 limit of 1000 bytes, got %d", limit)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	ctx := context.Background()
+	// Flush on every write.
+	tree := newTestTree(t, Options{MaxMemBytes: 1, MaxSSTables: 2})
+
+	for _, key := range []string{"ka", "kb"} {
+		if err := tree.Put([]byte(key), []byte("1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tree.Delete([]byte("ka")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tree.Get(ctx, []byte("ka")); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound from flushed tombstone, got %v", err)
+	}
+
+	if err := tree.Compact(0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Level 1 is the deepest level, so the tombstone is dropped together
+	// with the value it shadows.
+	if n := tree.levels[1][0].Meta().EntryCount; n != 1 {
+		t.Fatalf("expected a single entry after compaction, got %d", n)
+	}
+
+	if _, err := tree.Get(ctx, []byte("ka")); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after compaction, got %v", err)
+	}
+
+	// Keep the next tombstone in the memtable.
+	tree.maxMemBytes = 1 << 20
+
+	if err := tree.Delete([]byte("kb")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tree.Get(ctx, []byte("kb")); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound from memtable tombstone, got %v", err)
+	}
+}
+
+func TestStart(t *testing.T) {
+	tree := newTestTree(t, Options{MaxMemBytes: 1, MaxSSTables: 2})
+
+	tree.Start(context.Background())
+
+	for i := 0; i < 10; i++ {
+		key := []byte(fmt.Sprintf("key_%d", i))
+		if err := tree.Put(key, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		tree.lock.RLock()
+		n := len(tree.levels[0])
+		tree.lock.RUnlock()
+
+		if n <= 2 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("level 0 wasn't compacted, has %d sstables", n)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for i := 0; i < 10; i++ {
+		key := []byte(fmt.Sprintf("key_%d", i))
+		if _, err := tree.Get(context.Background(), key); err != nil {
+			t.Fatalf("get %s: %v", key, err)
+		}
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	ctx := context.Background()
+	fs := afero.NewMemMapFs()
+	opts := Options{MaxMemBytes: 10, MaxSSTables: 2}
+
+	tree, err := Open(fs, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each pair of writes is flushed to its own SSTable.
+	for i := 0; i < 10; i++ {
+		key := []byte(fmt.Sprintf("key_%d", i))
+		if err := tree.Put(key, []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tree.Compact(0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Close releases the files of all tables.
+	for i, level := range tree.levels {
+		for _, sst := range level {
+			if _, err := sst.Get([]byte("key_0")); !errors.Is(err, mem.ErrFileClosed) {
+				t.Fatalf("level %d: expected closed sstable, got %v", i, err)
+			}
+		}
+	}
+
+	reopened, err := Open(fs, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reopened.levels) != len(tree.levels) {
+		t.Fatalf("expected %d levels, got %d", len(tree.levels), len(reopened.levels))
+	}
+
+	for i := range tree.levels {
+		if len(reopened.levels[i]) != len(tree.levels[i]) {
+			t.Fatalf("level %d: expected %d sstables, got %d", i, len(tree.levels[i]), len(reopened.levels[i]))
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		key := []byte(fmt.Sprintf("key_%d", i))
+		if _, err := reopened.Get(ctx, key); err != nil {
+			t.Fatalf("get %s: %v", key, err)
+		}
+	}
+}
+
+func newTestTree(t *testing.T, opts Options) *LSMTree {
+	t.Helper()
+
+	return New(afero.NewMemMapFs(), opts)
+}
@@ -0,0 +1,136 @@
+package lsmtree
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// manifestName is the file that lists the live SSTables of the tree.
+const manifestName = "MANIFEST"
+
+// manifestEntry describes a single SSTable in the manifest. Entries are
+// stored in the order of the levels, and from oldest to newest within each
+// level.
+type manifestEntry struct {
+	Filename   string    `json:"filename"`
+	Level      int       `json:"level"`
+	MinKey     []byte    `json:"minKey"`
+	MaxKey     []byte    `json:"maxKey"`
+	EntryCount uint64    `json:"entryCount"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// writeManifest replaces the manifest with one listing the current levels.
+// It writes a temporary file first and renames it, so that the manifest is
+// never partially written. The caller must hold the write lock.
+func (t *LSMTree) writeManifest() error {
+	var entries []manifestEntry
+	for level, tables := range t.levels {
+		for _, sst := range tables {
+			meta := sst.Meta()
+			entries = append(entries, manifestEntry{
+				Filename:   sst.Name(),
+				Level:      level,
+				MinKey:     meta.MinKey,
+				MaxKey:     meta.MaxKey,
+				EntryCount: meta.EntryCount,
+				CreatedAt:  t.createdAt[sst],
+			})
+		}
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	tmp := manifestName + ".tmp"
+
+	f, err := t.fs.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("write: %w", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("sync: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close: %w", err)
+	}
+
+	if err := t.fs.Rename(tmp, manifestName); err != nil {
+		return fmt.Errorf("rename: %w", err)
+	}
+
+	return nil
+}
+
+// readManifest returns the entries of the manifest, or none if there is no
+// manifest yet.
+func readManifest(fs afero.Fs) ([]manifestEntry, error) {
+	data, err := afero.ReadFile(fs, manifestName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+
+	var entries []manifestEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+
+	return entries, nil
+}
+
+// Open creates a tree on fs like New and loads the SSTables listed in the
+// manifest written by a previous tree.
+//
+// Only flushed data is recovered, the content of the previous memtable is
+// lost.
+func Open(fs afero.Fs, opts Options) (*LSMTree, error) {
+	t := New(fs, opts)
+
+	entries, err := readManifest(fs)
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+
+	for _, e := range entries {
+		sst, err := t.manager.Open(e.Filename)
+		if err != nil {
+			return nil, fmt.Errorf("open sstable %s: %w", e.Filename, err)
+		}
+
+		for e.Level >= len(t.levels) {
+			t.levels = append(t.levels, nil)
+		}
+
+		t.levels[e.Level] = append(t.levels[e.Level], sst)
+		t.createdAt[sst] = e.CreatedAt
+	}
+
+	// Continue numbering writes after the ones that were flushed, so that
+	// new writes shadow them.
+	for _, level := range t.levels {
+		for _, sst := range level {
+			t.memtable.SetSeq(sst.Meta().MaxSeq)
+		}
+	}
+
+	return t, nil
+}
@@ -1,28 +1,94 @@
 package memtable
 
-import "bytes"
+import (
+	"bytes"
+	"fmt"
+	"iter"
+	"math"
+	"sync"
 
+	"github.com/DerGut/zomdb/pkg/log"
+)
+
+// MemTable is an in-memory, sorted key-value table. It is implemented as an
+// AVL tree, so that lookups and inserts stay O(log n) regardless of the
+// insertion order.
+//
+// Nodes are never modified once they are reachable from the root. Writes
+// copy the nodes on the path to the key instead (copy-on-write), so that
+// snapshots of the tree stay valid.
+//
+// A MemTable is safe for concurrent use. The zero value is an empty table.
 type MemTable struct {
+	lock sync.RWMutex
+
 	root *node
+
+	// size is the sum of all key and value sizes in bytes.
+	size int64
+
+	// seq is the sequence number of the latest write. Each write gets the
+	// next one, so that newer versions of a key always have a higher seq.
+	seq uint64
+
+	// wal records all writes before they are applied, if set.
+	wal *log.Log
 }
 
 type node struct {
 	key   []byte
 	value []byte
+	// deleted marks the node as a tombstone, it doesn't have a value.
+	deleted bool
+	// seq is the sequence number of the write that stored the node.
+	seq uint64
+
+	// height is the height of the subtree rooted at this node, with leaves
+	// having a height of 1.
+	height int
 
 	left, right *node
 }
 
 func (mt *MemTable) Get(key []byte) (value []byte, found bool) {
+	value, deleted, found := mt.Lookup(key)
+	if deleted {
+		return nil, false
+	}
+
+	return value, found
+}
+
+// Lookup is like Get but also reports whether the key was deleted, i.e.
+// whether the table holds a tombstone for it.
+func (mt *MemTable) Lookup(key []byte) (value []byte, deleted, found bool) {
+	return mt.LookupAt(key, math.MaxUint64)
+}
+
+// LookupAt is like Lookup but ignores writes with a sequence number higher
+// than seq. The table only keeps the latest version of each key, so a key
+// that was overwritten after seq isn't found at all.
+func (mt *MemTable) LookupAt(key []byte, seq uint64) (value []byte, deleted, found bool) {
+	mt.lock.RLock()
+	defer mt.lock.RUnlock()
+
 	current := mt.root
 	for {
 		if current == nil {
-			return nil, false
+			return nil, false, false
 		}
 
-		switch bytes.Compare(current.key, key) {
+		switch bytes.Compare(key, current.key) {
 		case 0:
-			return current.value, true
+			if current.seq > seq {
+				return nil, false, false
+			}
+
+			if current.deleted {
+				return nil, true, true
+			}
+
+			return current.value, false, true
 		case -1:
 			current = current.left
 		case +1:
@@ -32,30 +98,285 @@ func (mt *MemTable) Get(key []byte) (value []byte, found bool) {
 }
 
 func (mt *MemTable) Put(key, value []byte) error {
-	current := mt.root
-	for {
-		if current == nil {
-			// Add new node
-			current = &node{
-				key:   key,
-				value: value,
-			}
-			return nil
+	if value == nil {
+		// nil values are reserved for tombstones in InOrder.
+		value = []byte{}
+	}
+
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+
+	if err := mt.logWrite(opPut, key, value); err != nil {
+		return fmt.Errorf("wal: %w", err)
+	}
+
+	mt.seq++
+	mt.root = mt.insert(mt.root, key, value, false)
+	return nil
+}
+
+// Delete marks the key as deleted. Instead of removing the key, a tombstone
+// is stored that shadows older values of the key once the table is flushed.
+func (mt *MemTable) Delete(key []byte) error {
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+
+	if err := mt.logWrite(opDelete, key, nil); err != nil {
+		return fmt.Errorf("wal: %w", err)
+	}
+
+	mt.seq++
+	mt.root = mt.insert(mt.root, key, nil, true)
+	return nil
+}
+
+// Clear removes all entries from the table, so that it can be reused after
+// a flush. Snapshots taken before stay valid. The WAL isn't touched, use
+// TruncateWAL once the flushed data is durable. Sequence numbers continue
+// where they left off.
+func (mt *MemTable) Clear() {
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+
+	mt.root = nil
+	mt.size = 0
+}
+
+// Seq returns the sequence number of the latest write.
+func (mt *MemTable) Seq() uint64 {
+	mt.lock.RLock()
+	defer mt.lock.RUnlock()
+
+	return mt.seq
+}
+
+// SetSeq makes the table continue numbering writes after seq, e.g. after
+// the latest write that a previous table flushed. It never moves the
+// sequence number backwards.
+func (mt *MemTable) SetSeq(seq uint64) {
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+
+	mt.seq = max(mt.seq, seq)
+}
+
+// insert adds the key-value pair, or a tombstone if deleted is set, to the
+// subtree rooted at n and returns the root of the rebalanced subtree. The
+// node gets the table's current sequence number.
+//
+// The nodes on the path to the key are copied before they are modified.
+// Rebalancing only rotates nodes on that path, so the original subtree is
+// left untouched.
+func (mt *MemTable) insert(n *node, key, value []byte, deleted bool) *node {
+	if n == nil {
+		// Add new node
+		mt.size += int64(len(key) + len(value))
+		return &node{
+			key:     key,
+			value:   value,
+			deleted: deleted,
+			seq:     mt.seq,
+			height:  1,
 		}
+	}
 
-		switch bytes.Compare(current.key, key) {
-		case 0:
-			// Overwrite node
-			current.value = value
-			return nil
-		case -1:
-			current = current.left
-		case +1:
-			current = current.right
+	c := *n
+	n = &c
+
+	switch bytes.Compare(key, n.key) {
+	case 0:
+		// Overwrite node
+		mt.size += int64(len(value) - len(n.value))
+		n.value = value
+		n.deleted = deleted
+		n.seq = mt.seq
+		return n
+	case -1:
+		n.left = mt.insert(n.left, key, value, deleted)
+	case +1:
+		n.right = mt.insert(n.right, key, value, deleted)
+	}
+
+	return n.rebalance()
+}
+
+// rebalance restores the AVL property of the subtree rooted at n, assuming
+// that both of its children are balanced. It returns the new subtree root.
+func (n *node) rebalance() *node {
+	n.updateHeight()
+
+	switch balance := n.balance(); {
+	case balance > 1:
+		if n.left.balance() < 0 {
+			// Left-right case
+			n.left = n.left.rotateLeft()
+		}
+
+		return n.rotateRight()
+	case balance < -1:
+		if n.right.balance() > 0 {
+			// Right-left case
+			n.right = n.right.rotateRight()
 		}
+
+		return n.rotateLeft()
 	}
+
+	return n
+}
+
+// rotateRight rotates the subtree to the right and returns its new root:
+//
+//	    n          l
+//	   / \        / \
+//	  l   c  ->  a   n
+//	 / \            / \
+//	a   b          b   c
+func (n *node) rotateRight() *node {
+	l := n.left
+	n.left = l.right
+	l.right = n
+
+	n.updateHeight()
+	l.updateHeight()
+
+	return l
+}
+
+// rotateLeft rotates the subtree to the left and returns its new root:
+//
+//	  n              r
+//	 / \            / \
+//	a   r    ->    n   c
+//	   / \        / \
+//	  b   c      a   b
+func (n *node) rotateLeft() *node {
+	r := n.right
+	n.right = r.left
+	r.left = n
+
+	n.updateHeight()
+	r.updateHeight()
+
+	return r
+}
+
+func (n *node) updateHeight() {
+	n.height = 1 + max(n.left.getHeight(), n.right.getHeight())
+}
+
+// balance returns the height difference between the left and right subtree.
+func (n *node) balance() int {
+	return n.left.getHeight() - n.right.getHeight()
+}
+
+func (n *node) getHeight() int {
+	if n == nil {
+		return 0
+	}
+
+	return n.height
+}
+
+// MemTableSnapshot is a read-only view of a MemTable at the time the
+// snapshot was taken. Later writes to the table don't affect it.
+type MemTableSnapshot struct {
+	root *node
+}
+
+// Snapshot captures the current state of the table. Taking a snapshot is
+// cheap, since the tree isn't copied.
+func (mt *MemTable) Snapshot() *MemTableSnapshot {
+	mt.lock.RLock()
+	defer mt.lock.RUnlock()
+
+	return &MemTableSnapshot{root: mt.root}
 }
 
-func (mt *MemTable) Traverse() {
+// InOrder returns an iterator over all key-value pairs of the snapshot,
+// ordered by key. Deleted keys are yielded with a nil value.
+//
+// Unlike MemTable.InOrder, the table isn't locked during the iteration.
+func (s *MemTableSnapshot) InOrder() iter.Seq2[[]byte, []byte] {
+	return func(yield func(k, v []byte) bool) {
+		s.root.walk(yield)
+	}
+}
+
+// Entry is a single entry of a MemTableSnapshot.
+type Entry struct {
+	Key, Value []byte
+	// Deleted marks the entry as a tombstone, its Value is nil.
+	Deleted bool
+	// Seq is the sequence number of the write that stored the entry.
+	Seq uint64
+}
+
+// Entries is like InOrder but yields the entries with their tombstone
+// marker and sequence number.
+func (s *MemTableSnapshot) Entries() iter.Seq[Entry] {
+	return func(yield func(Entry) bool) {
+		s.root.walkNodes(func(n *node) bool {
+			e := Entry{Key: n.key, Deleted: n.deleted, Seq: n.seq}
+			if !n.deleted {
+				e.Value = n.value
+			}
+
+			return yield(e)
+		})
+	}
+}
+
+// ByteSize returns the total size of all keys and values stored in the
+// table.
+func (mt *MemTable) ByteSize() int64 {
+	mt.lock.RLock()
+	defer mt.lock.RUnlock()
+
+	return mt.size
+}
+
+// Exceeds reports whether the table holds more than limit bytes.
+func (mt *MemTable) Exceeds(limit int64) bool {
+	return mt.ByteSize() > limit
+}
+
+// InOrder returns an iterator over all key-value pairs of the table, ordered
+// by key. Deleted keys are yielded with a nil value.
+//
+// The table is read-locked for the whole iteration, so the loop body must
+// not write to it.
+func (mt *MemTable) InOrder() iter.Seq2[[]byte, []byte] {
+	return func(yield func(k, v []byte) bool) {
+		mt.lock.RLock()
+		defer mt.lock.RUnlock()
+
+		mt.root.walk(yield)
+	}
+}
+
+// walk traverses the subtree in order. It returns false if yield asked to
+// stop the traversal.
+func (n *node) walk(yield func(k, v []byte) bool) bool {
+	if n == nil {
+		return true
+	}
+
+	return n.walkNodes(func(n *node) bool {
+		value := n.value
+		if n.deleted {
+			value = nil
+		}
+
+		return yield(n.key, value)
+	})
+}
+
+// walkNodes is like walk but yields the nodes themselves.
+func (n *node) walkNodes(yield func(n *node) bool) bool {
+	if n == nil {
+		return true
+	}
 
+	return n.left.walkNodes(yield) && yield(n) && n.right.walkNodes(yield)
 }
@@ -0,0 +1,633 @@
+package memtable
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/DerGut/zomdb/pkg/log"
+	"github.com/spf13/afero"
+)
+
+func TestMemTableConcurrent(t *testing.T) {
+	var mt MemTable
+	var wg sync.WaitGroup
+
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < 100; i++ {
+				key := []byte(fmt.Sprintf("key_%d_%d", g, i))
+				if err := mt.Put(key, key); err != nil {
+					t.Error(err)
+				}
+
+				mt.Get(key)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	var n int
+	for range mt.InOrder() {
+		n++
+	}
+
+	if n != 400 {
+		t.Fatalf("expected 400 keys, got %d", n)
+	}
+}
+
+func TestMemTableBalanced(t *testing.T) {
+	var mt MemTable
+
+	// Sorted inserts degenerate an unbalanced tree into a list.
+	const n = 1000
+	for i := 0; i < n; i++ {
+		key := []byte(fmt.Sprintf("key_%04d", i))
+		if err := mt.Put(key, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkBalanced(t, mt.root)
+
+	// An AVL tree's height is bounded by ~1.44 * log2(n).
+	if h := mt.root.height; h > 15 {
+		t.Fatalf("expected height <= 15, got %d", h)
+	}
+
+	for i := 0; i < n; i++ {
+		key := []byte(fmt.Sprintf("key_%04d", i))
+		if _, found := mt.Get(key); !found {
+			t.Fatalf("key %q not found", key)
+		}
+	}
+}
+
+func checkBalanced(t *testing.T, n *node) int {
+	t.Helper()
+
+	if n == nil {
+		return 0
+	}
+
+	if n.left != nil && bytes.Compare(n.left.key, n.key) >= 0 {
+		t.Fatalf("left child %q >= %q", n.left.key, n.key)
+	}
+
+	if n.right != nil && bytes.Compare(n.right.key, n.key) <= 0 {
+		t.Fatalf("right child %q <= %q", n.right.key, n.key)
+	}
+
+	l, r := checkBalanced(t, n.left), checkBalanced(t, n.right)
+	if l-r > 1 || r-l > 1 {
+		t.Fatalf("node %q is unbalanced: %d vs %d", n.key, l, r)
+	}
+
+	if h := 1 + max(l, r); h != n.height {
+		t.Fatalf("node %q has height %d, expected %d", n.key, n.height, h)
+	}
+
+	return n.height
+}
+
+func TestMemTableByteSize(t *testing.T) {
+	var mt MemTable
+
+	if mt.ByteSize() != 0 {
+		t.Fatalf("expected empty table to have size 0, got %d", mt.ByteSize())
+	}
+
+	mt.Put([]byte("key"), []byte("value"))
+	mt.Put([]byte("other"), []byte("1"))
+
+	if got := mt.ByteSize(); got != 14 {
+		t.Fatalf("expected size 14, got %d", got)
+	}
+
+	// Overwrites only account for the difference in value size.
+	mt.Put([]byte("key"), []byte("v"))
+
+	if got := mt.ByteSize(); got != 10 {
+		t.Fatalf("expected size 10, got %d", got)
+	}
+
+	if !mt.Exceeds(9) {
+		t.Fatal("expected table to exceed 9 bytes")
+	}
+
+	if mt.Exceeds(10) {
+		t.Fatal("expected table not to exceed 10 bytes")
+	}
+}
+
+func TestMemTableInOrder(t *testing.T) {
+	var mt MemTable
+
+	for range mt.InOrder() {
+		t.Fatal("expected empty table to yield nothing")
+	}
+
+	for _, key := range []string{"m", "c", "x", "a", "e", "z", "n"} {
+		if err := mt.Put([]byte(key), []byte("v"+key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var keys string
+	for k, v := range mt.InOrder() {
+		if !bytes.Equal(v, []byte("v"+string(k))) {
+			t.Fatalf("unexpected value %q for key %q", v, k)
+		}
+
+		keys += string(k)
+	}
+
+	if keys != "acemnxz" {
+		t.Fatalf("expected keys in order %q, got %q", "acemnxz", keys)
+	}
+
+	var n int
+	for range mt.InOrder() {
+		n++
+		if n == 3 {
+			break
+		}
+	}
+}
+
+func TestMemTable(t *testing.T) {
+	var mt MemTable
+
+	if _, found := mt.Get([]byte("key")); found {
+		t.Fatal("expected empty table not to contain key")
+	}
+
+	if err := mt.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+
+	value, found := mt.Get([]byte("key"))
+	if !found {
+		t.Fatal("expected key to be found")
+	}
+
+	if !bytes.Equal(value, []byte("value")) {
+		t.Fatalf("expected %q, got %q", "value", value)
+	}
+}
+
+func TestMemTablePutMultiple(t *testing.T) {
+	var mt MemTable
+
+	for _, i := range []int{5, 2, 8, 1, 9, 3, 7} {
+		key := []byte(fmt.Sprintf("key_%d", i))
+		value := []byte(fmt.Sprintf("value_%d", i))
+		if err := mt.Put(key, value); err != nil {
+			t.Fatalf("put %d: %v", i, err)
+		}
+	}
+
+	for _, i := range []int{1, 2, 3, 5, 7, 8, 9} {
+		key := []byte(fmt.Sprintf("key_%d", i))
+		want := []byte(fmt.Sprintf("value_%d", i))
+
+		got, found := mt.Get(key)
+		if !found {
+			t.Fatalf("get %d: not found", i)
+		}
+
+		if !bytes.Equal(got, want) {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	}
+
+	if _, found := mt.Get([]byte("key_4")); found {
+		t.Fatal("expected key_4 not to be found")
+	}
+}
+
+func TestMemTablePutOverwrite(t *testing.T) {
+	var mt MemTable
+
+	if err := mt.Put([]byte("color"), []byte("red")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mt.Put([]byte("color"), []byte("green")); err != nil {
+		t.Fatal(err)
+	}
+
+	value, _ := mt.Get([]byte("color"))
+	if !bytes.Equal(value, []byte("green")) {
+		t.Fatalf("want color=green, got: %s", value)
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	mt := newBenchMemTable(b)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		mt.Get([]byte(fmt.Sprintf("key_%d", i%benchTableSize)))
+	}
+}
+
+func BenchmarkGetParallel(b *testing.B) {
+	mt := newBenchMemTable(b)
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			mt.Get([]byte(fmt.Sprintf("key_%d", i%benchTableSize)))
+			i++
+		}
+	})
+}
+
+func BenchmarkGetParallelWithWrites(b *testing.B) {
+	mt := newBenchMemTable(b)
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			key := []byte(fmt.Sprintf("key_%d", i%benchTableSize))
+			if i%10 == 0 {
+				mt.Put(key, key)
+			} else {
+				mt.Get(key)
+			}
+			i++
+		}
+	})
+}
+
+const benchTableSize = 10000
+
+func newBenchMemTable(b *testing.B) *MemTable {
+	b.Helper()
+
+	var mt MemTable
+	for i := 0; i < benchTableSize; i++ {
+		key := []byte(fmt.Sprintf("key_%d", i))
+		if err := mt.Put(key, key); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	return &mt
+}
+
+func TestMemTableDelete(t *testing.T) {
+	var mt MemTable
+
+	for _, key := range []string{"a", "b", "c"} {
+		if err := mt.Put([]byte(key), []byte("v"+key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, key := range []string{"b", "d"} {
+		if err := mt.Delete([]byte(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, found := mt.Get([]byte("b")); found {
+		t.Fatal("expected deleted key not to be found")
+	}
+
+	if value, found := mt.Get([]byte("a")); !found || !bytes.Equal(value, []byte("va")) {
+		t.Fatalf("expected %q, got %q", "va", value)
+	}
+
+	var keys, deleted string
+	for k, v := range mt.InOrder() {
+		keys += string(k)
+		if v == nil {
+			deleted += string(k)
+		}
+	}
+
+	if keys != "abcd" || deleted != "bd" {
+		t.Fatalf("expected keys %q with tombstones %q, got %q and %q", "abcd", "bd", keys, deleted)
+	}
+
+	// Overwriting a tombstone restores the key.
+	if err := mt.Put([]byte("b"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if value, found := mt.Get([]byte("b")); !found || value == nil {
+		t.Fatalf("expected empty value, got %v, %t", value, found)
+	}
+
+	if want := int64(len("abcd") + len("vavc")); mt.ByteSize() != want {
+		t.Fatalf("expected %d bytes, got %d", want, mt.ByteSize())
+	}
+}
+
+func TestMemTableClear(t *testing.T) {
+	var mt MemTable
+
+	for _, key := range []string{"a", "b"} {
+		if err := mt.Put([]byte(key), []byte("v"+key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snap := mt.Snapshot()
+	mt.Clear()
+
+	if _, found := mt.Get([]byte("a")); found {
+		t.Fatal("expected cleared table to be empty")
+	}
+
+	if mt.ByteSize() != 0 {
+		t.Fatalf("expected 0 bytes, got %d", mt.ByteSize())
+	}
+
+	var keys string
+	for k := range snap.InOrder() {
+		keys += string(k)
+	}
+
+	if keys != "ab" {
+		t.Fatalf("expected snapshot keys %q, got %q", "ab", keys)
+	}
+
+	if err := mt.Put([]byte("c"), []byte("vc")); err != nil {
+		t.Fatal(err)
+	}
+
+	if value, found := mt.Get([]byte("c")); !found || !bytes.Equal(value, []byte("vc")) {
+		t.Fatalf("expected %q, got %q", "vc", value)
+	}
+}
+
+func TestMemTableRecover(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	wal, err := log.New(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mt := (&MemTable{}).WithWAL(wal)
+	for _, key := range []string{"a", "b", "c"} {
+		if err := mt.Put([]byte(key), []byte("v"+key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := mt.Delete([]byte("b")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash in the middle of writing a record.
+	if _, err := wal.Append([]byte{0, 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := wal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	wal, err = log.New(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var recovered MemTable
+	if err := recovered.Recover(wal); err != nil {
+		t.Fatal(err)
+	}
+
+	if value, found := recovered.Get([]byte("a")); !found || !bytes.Equal(value, []byte("va")) {
+		t.Fatalf("expected %q, got %q", "va", value)
+	}
+
+	if _, found := recovered.Get([]byte("b")); found {
+		t.Fatal("expected deleted key not to be found")
+	}
+
+	// Only the torn record was cut, the acknowledged ones stay in place.
+	var n int
+	records, errFn := wal.Entries(0)
+	for range records {
+		n++
+	}
+
+	if err := errFn(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 4 {
+		t.Fatalf("expected 4 records, got %d", n)
+	}
+
+	// The torn record is gone, so writes after recovery can be replayed.
+	recovered.WithWAL(wal)
+	if err := recovered.Put([]byte("d"), []byte("vd")); err != nil {
+		t.Fatal(err)
+	}
+
+	var again MemTable
+	if err := again.Recover(wal); err != nil {
+		t.Fatal(err)
+	}
+
+	var keys string
+	for k, v := range again.InOrder() {
+		if v != nil {
+			keys += string(k)
+		}
+	}
+
+	if keys != "acd" {
+		t.Fatalf("expected keys %q, got %q", "acd", keys)
+	}
+}
+
+func TestMemTableTruncateWAL(t *testing.T) {
+	wal, err := log.New(afero.NewMemMapFs())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mt := (&MemTable{}).WithWAL(wal)
+	if err := mt.Put([]byte("a"), []byte("va")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mt.TruncateWAL(); err != nil {
+		t.Fatal(err)
+	}
+
+	var recovered MemTable
+	if err := recovered.Recover(wal); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, found := recovered.Get([]byte("a")); found {
+		t.Fatal("expected truncated WAL to be empty")
+	}
+}
+
+func TestMemTableSnapshot(t *testing.T) {
+	var mt MemTable
+
+	for i := 0; i < 100; i += 2 {
+		key := []byte(fmt.Sprintf("key_%03d", i))
+		if err := mt.Put(key, []byte("old")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snap := mt.Snapshot()
+
+	// Interleaved inserts, overwrites and deletes rebalance the tree.
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key_%03d", i))
+
+		var err error
+		if i%3 == 0 {
+			err = mt.Delete(key)
+		} else {
+			err = mt.Put(key, []byte("new"))
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkBalanced(t, mt.root)
+
+	var n int
+	for k, v := range snap.InOrder() {
+		if !bytes.Equal(v, []byte("old")) {
+			t.Fatalf("expected snapshot value %q for %s, got %q", "old", k, v)
+		}
+
+		n++
+	}
+
+	if n != 50 {
+		t.Fatalf("expected 50 keys in snapshot, got %d", n)
+	}
+
+	n = 0
+	for range mt.InOrder() {
+		n++
+	}
+
+	if n != 100 {
+		t.Fatalf("expected 100 keys in table, got %d", n)
+	}
+
+	// Snapshots can be iterated while the table is written to.
+	snap = mt.Snapshot()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for i := 0; i < 100; i++ {
+			if err := mt.Put([]byte(fmt.Sprintf("more_%03d", i)), []byte("v")); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+
+	n = 0
+	for range snap.InOrder() {
+		n++
+	}
+
+	<-done
+
+	if n != 100 {
+		t.Fatalf("expected 100 keys in snapshot, got %d", n)
+	}
+}
+
+func TestMemTableSeq(t *testing.T) {
+	var mt MemTable
+
+	if err := mt.Put([]byte("a"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mt.Put([]byte("b"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mt.Delete([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	if seq := mt.Seq(); seq != 3 {
+		t.Fatalf("expected seq 3, got %d", seq)
+	}
+
+	// The tombstone replaced the first version of a.
+	if _, _, found := mt.LookupAt([]byte("a"), 2); found {
+		t.Fatal("expected a to be hidden at seq 2")
+	}
+
+	if _, deleted, found := mt.LookupAt([]byte("a"), 3); !found || !deleted {
+		t.Fatalf("expected tombstone for a at seq 3, got deleted=%t found=%t", deleted, found)
+	}
+
+	if value, _, found := mt.LookupAt([]byte("b"), 2); !found || !bytes.Equal(value, []byte("1")) {
+		t.Fatalf("expected b at seq 2, got %q found=%t", value, found)
+	}
+
+	want := []Entry{
+		{Key: []byte("a"), Deleted: true, Seq: 3},
+		{Key: []byte("b"), Value: []byte("1"), Seq: 2},
+	}
+
+	var got []Entry
+	for e := range mt.Snapshot().Entries() {
+		got = append(got, e)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected entries %v, got %v", want, got)
+	}
+
+	// Sequence numbers survive clearing and never move backwards.
+	mt.Clear()
+	mt.SetSeq(1)
+
+	if err := mt.Put([]byte("c"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	if seq := mt.Seq(); seq != 4 {
+		t.Fatalf("expected seq 4, got %d", seq)
+	}
+
+	mt.SetSeq(10)
+
+	if err := mt.Put([]byte("c"), []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+
+	if seq := mt.Seq(); seq != 11 {
+		t.Fatalf("expected seq 11, got %d", seq)
+	}
+}
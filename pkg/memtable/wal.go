@@ -0,0 +1,157 @@
+package memtable
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/DerGut/zomdb/pkg/log"
+)
+
+// Operations recorded in the write-ahead log.
+const (
+	opPut    byte = 1
+	opDelete byte = 2
+)
+
+// walRecordHeaderSize is the size of the fixed fields of a WAL record:
+//
+//	op (1B) | keyLen (2B) | key | valueLen (4B) | value
+const walRecordHeaderSize = 7
+
+// WithWAL makes the table record every Put and Delete in the write-ahead
+// log before applying it, so that the table can be recovered after a crash.
+// It returns the table for chaining.
+func (mt *MemTable) WithWAL(l *log.Log) *MemTable {
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+
+	mt.wal = l
+	return mt
+}
+
+// Recover rebuilds the table from the records of the write-ahead log.
+//
+// A torn last record, e.g. from a crash while writing it, was never
+// acknowledged and is dropped. Only the torn bytes are cut from the log,
+// so that later records don't follow them. The acknowledged records stay
+// in place.
+func (mt *MemTable) Recover(l *log.Log) error {
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+
+	// last is the offset of the last valid record, if any.
+	last := int64(-1)
+	records, replayErr := l.Entries(0)
+	for off, data := range records {
+		op, key, value, err := decodeWALRecord(data)
+		if err != nil {
+			return fmt.Errorf("record at offset %d: %w", off, err)
+		}
+
+		mt.seq++
+		mt.root = mt.insert(mt.root, key, value, op == opDelete)
+		last = off
+	}
+
+	err := replayErr()
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("replay: %w", err)
+	}
+
+	// The torn record starts right after the last valid one.
+	var end int64
+	if last >= 0 {
+		_, next, err := l.ReadRecord(last)
+		if err != nil {
+			return fmt.Errorf("read last record: %w", err)
+		}
+
+		end = next
+	}
+
+	if err := l.TruncateAt(end); err != nil {
+		return fmt.Errorf("truncate torn record: %w", err)
+	}
+
+	return nil
+}
+
+// TruncateWAL clears the write-ahead log. It should be called once the
+// content of the table has been persisted elsewhere, e.g. flushed to an
+// SSTable.
+func (mt *MemTable) TruncateWAL() error {
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+
+	if mt.wal == nil {
+		return nil
+	}
+
+	return mt.wal.Truncate()
+}
+
+// logWrite appends the operation to the write-ahead log, if any, and syncs
+// it. The caller must hold the write lock.
+func (mt *MemTable) logWrite(op byte, key, value []byte) error {
+	if mt.wal == nil {
+		return nil
+	}
+
+	if _, err := mt.wal.AppendRecord(encodeWALRecord(op, key, value)); err != nil {
+		return fmt.Errorf("append: %w", err)
+	}
+
+	if err := mt.wal.Sync(); err != nil {
+		return fmt.Errorf("sync: %w", err)
+	}
+
+	return nil
+}
+
+func encodeWALRecord(op byte, key, value []byte) []byte {
+	data := make([]byte, walRecordHeaderSize+len(key)+len(value))
+
+	data[0] = op
+	binary.BigEndian.PutUint16(data[1:3], uint16(len(key)))
+	copy(data[3:], key)
+	binary.BigEndian.PutUint32(data[3+len(key):], uint32(len(value)))
+	copy(data[7+len(key):], value)
+
+	return data
+}
+
+func decodeWALRecord(data []byte) (op byte, key, value []byte, err error) {
+	if len(data) < walRecordHeaderSize {
+		return 0, nil, nil, errors.New("record too short")
+	}
+
+	op = data[0]
+	if op != opPut && op != opDelete {
+		return 0, nil, nil, fmt.Errorf("unknown op %d", op)
+	}
+
+	keyLen := int(binary.BigEndian.Uint16(data[1:3]))
+	if len(data) < walRecordHeaderSize+keyLen {
+		return 0, nil, nil, errors.New("record too short")
+	}
+
+	key = data[3 : 3+keyLen]
+
+	valueLen := int(binary.BigEndian.Uint32(data[3+keyLen:]))
+	if len(data) != walRecordHeaderSize+keyLen+valueLen {
+		return 0, nil, nil, errors.New("record length doesn't match")
+	}
+
+	if op == opPut {
+		// Values are never nil, that's reserved for tombstones.
+		value = append([]byte{}, data[7+keyLen:]...)
+	}
+
+	return op, key, value, nil
+}
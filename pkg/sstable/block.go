@@ -0,0 +1,261 @@
+package sstable
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+)
+
+// blockHeaderSize is the size of the header preceding each block's entries:
+//
+//	entryCount (4B) | compression (1B) | size (4B) | checksum (4B)
+//
+// compression is the CompressionType the entries are stored with. size is
+// the byte size of the entries following the header as stored on disk, i.e.
+// after compression. checksum is the CRC-32 (IEEE) of the stored entries.
+const blockHeaderSize = 13
+
+// CompressionType is the algorithm blocks are compressed with. It is stored
+// in each block header, so further algorithms like Snappy or Zstandard can
+// be added without changing the table format.
+type CompressionType uint8
+
+const (
+	CompressionNone CompressionType = iota
+	// CompressionFlate compresses blocks with DEFLATE (RFC 1951). It is
+	// slower than Snappy or Zstandard, but part of the standard library,
+	// which keeps the module free of dependencies beyond afero.
+	CompressionFlate
+)
+
+// blockHandle locates a block in the table file. It is stored in the block
+// index at the end of the file.
+type blockHandle struct {
+	// off is the offset of the block header.
+	off int64
+	// size is the size of the block's entries, excluding its header.
+	size int64
+	// firstKey is the smallest key stored in the block.
+	firstKey []byte
+}
+
+func (h *blockHandle) MarshalBinary() (data []byte, err error) {
+	data = make([]byte, 14+len(h.firstKey))
+
+	binary.BigEndian.PutUint64(data[:8], uint64(h.off))
+	binary.BigEndian.PutUint32(data[8:12], uint32(h.size))
+	binary.BigEndian.PutUint16(data[12:14], uint16(len(h.firstKey)))
+	copy(data[14:], h.firstKey)
+
+	return data, nil
+}
+
+func (h *blockHandle) UnmarshalBinary(data []byte) error {
+	if len(data) < 14 {
+		return errors.New("len(data) < 14")
+	}
+
+	keySize := int(binary.BigEndian.Uint16(data[12:14]))
+	if len(data) < 14+keySize {
+		return fmt.Errorf("len(data) < len(handle): %d < %d", len(data), 14+keySize)
+	}
+
+	h.off = int64(binary.BigEndian.Uint64(data[:8]))
+	h.size = int64(binary.BigEndian.Uint32(data[8:12]))
+	h.firstKey = data[14 : 14+keySize]
+
+	return nil
+}
+
+// blockWriter groups entries into blocks of about BlockSize bytes and
+// records a handle for each written block.
+type blockWriter struct {
+	w           io.Writer
+	off         int64
+	compression CompressionType
+
+	buf      bytes.Buffer
+	count    uint32
+	firstKey []byte
+
+	handles []blockHandle
+}
+
+// add appends the marshaled entry to the current block and writes the
+// block once it exceeds BlockSize.
+func (b *blockWriter) add(key, data []byte) error {
+	if b.count == 0 {
+		b.firstKey = key
+	}
+
+	b.buf.Write(data)
+	b.count++
+
+	if b.buf.Len() >= BlockSize {
+		return b.flush()
+	}
+
+	return nil
+}
+
+// flush writes the current block, if it holds any entries.
+func (b *blockWriter) flush() error {
+	if b.count == 0 {
+		return nil
+	}
+
+	compression, data, err := compress(b.compression, b.buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("compress block: %w", err)
+	}
+
+	header := make([]byte, blockHeaderSize)
+	binary.BigEndian.PutUint32(header[0:4], b.count)
+	header[4] = byte(compression)
+	binary.BigEndian.PutUint32(header[5:9], uint32(len(data)))
+	binary.BigEndian.PutUint32(header[9:13], crc32.ChecksumIEEE(data))
+
+	if _, err := b.w.Write(header); err != nil {
+		return fmt.Errorf("write block header: %w", err)
+	}
+
+	if _, err := b.w.Write(data); err != nil {
+		return fmt.Errorf("write block: %w", err)
+	}
+
+	b.handles = append(b.handles, blockHandle{
+		off:      b.off,
+		size:     int64(len(data)),
+		firstKey: b.firstKey,
+	})
+
+	b.off += int64(blockHeaderSize + len(data))
+	b.buf.Reset()
+	b.count = 0
+	b.firstKey = nil
+
+	return nil
+}
+
+// compress compresses the block's entries with the given algorithm. It
+// falls back to storing them uncompressed if compression doesn't save
+// space, and returns the algorithm that was actually used.
+func compress(c CompressionType, entries []byte) (CompressionType, []byte, error) {
+	switch c {
+	case CompressionNone:
+		return CompressionNone, entries, nil
+	case CompressionFlate:
+		var buf bytes.Buffer
+		w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if _, err := w.Write(entries); err != nil {
+			return 0, nil, err
+		}
+
+		if err := w.Close(); err != nil {
+			return 0, nil, err
+		}
+
+		if buf.Len() >= len(entries) {
+			return CompressionNone, entries, nil
+		}
+
+		return CompressionFlate, buf.Bytes(), nil
+	default:
+		return 0, nil, fmt.Errorf("unknown compression type %d", c)
+	}
+}
+
+// decompress reverses compress.
+func decompress(c CompressionType, data []byte) ([]byte, error) {
+	switch c {
+	case CompressionNone:
+		return data, nil
+	case CompressionFlate:
+		r := flate.NewReader(bytes.NewReader(data))
+		defer r.Close()
+
+		return io.ReadAll(r)
+	default:
+		return nil, fmt.Errorf("unknown compression type %d", c)
+	}
+}
+
+// readBlock reads the entries of the i-th block, verifies their checksum
+// and decompresses them.
+func (t *SSTable) readBlock(i int) ([]byte, error) {
+	h := t.index[i]
+
+	data := make([]byte, blockHeaderSize+h.size)
+	if _, err := t.file.ReadAt(data, h.off); err != nil {
+		return nil, fmt.Errorf("read block %d: %w", i, err)
+	}
+
+	header, stored := data[:blockHeaderSize], data[blockHeaderSize:]
+	if int64(binary.BigEndian.Uint32(header[5:9])) != h.size {
+		return nil, fmt.Errorf("file is corrupt: block %d: size doesn't match index", i)
+	}
+
+	if crc32.ChecksumIEEE(stored) != binary.BigEndian.Uint32(header[9:13]) {
+		return nil, fmt.Errorf("file is corrupt: block %d: checksum mismatch", i)
+	}
+
+	entries, err := decompress(CompressionType(header[4]), stored)
+	if err != nil {
+		return nil, fmt.Errorf("file is corrupt: block %d: %w", i, err)
+	}
+
+	return entries, nil
+}
+
+// blockFor returns the index of the block that would contain key, or -1 if
+// key is smaller than all keys of the table.
+func (t *SSTable) blockFor(key []byte) int {
+	i := sort.Search(len(t.index), func(i int) bool {
+		return bytes.Compare(t.index[i].firstKey, key) > 0
+	})
+
+	return i - 1
+}
+
+// blocks returns a reader over the entries of all blocks, starting at the
+// i-th block.
+func (t *SSTable) blocks(i int) io.Reader {
+	return &blockReader{t: t, next: i}
+}
+
+// blockReader reads the entries of consecutive blocks.
+type blockReader struct {
+	t    *SSTable
+	next int
+	buf  []byte
+}
+
+func (r *blockReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.next >= len(r.t.index) {
+			return 0, io.EOF
+		}
+
+		entries, err := r.t.readBlock(r.next)
+		if err != nil {
+			return 0, err
+		}
+
+		r.buf = entries
+		r.next++
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+
+	return n, nil
+}
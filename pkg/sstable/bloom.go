@@ -0,0 +1,104 @@
+package sstable
+
+import (
+	"encoding"
+	"errors"
+	"hash/fnv"
+	"math"
+)
+
+// bloomFilter is a probabilistic set that can tell for certain that a key
+// is not part of an SSTable. It may report false positives, but never
+// false negatives.
+//
+// Bit positions are derived with double hashing: a single 64-bit FNV-1a hash
+// is split into two 32-bit halves h1 and h2, and the i-th position is
+// computed as h1 + i*h2.
+type bloomFilter struct {
+	bits []byte
+	k    uint8
+}
+
+var _ encoding.BinaryMarshaler = &bloomFilter{}
+var _ encoding.BinaryUnmarshaler = &bloomFilter{}
+
+// newBloomFilter creates an empty filter sized to hold n keys with a false
+// positive rate of about fpr.
+func newBloomFilter(n int, fpr float64) *bloomFilter {
+	if n < 1 {
+		n = 1
+	}
+
+	if fpr <= 0 || fpr >= 1 {
+		fpr = 0.01
+	}
+
+	// Optimal number of bits m and hash functions k for n keys:
+	//   m = -n * ln(fpr) / ln(2)^2
+	//   k = m/n * ln(2)
+	m := math.Ceil(-float64(n) * math.Log(fpr) / (math.Ln2 * math.Ln2))
+	k := math.Round(m / float64(n) * math.Ln2)
+
+	k = math.Max(1, math.Min(k, math.MaxUint8))
+
+	return &bloomFilter{
+		bits: make([]byte, (int(m)+7)/8),
+		k:    uint8(k),
+	}
+}
+
+func (f *bloomFilter) add(key []byte) {
+	h1, h2 := bloomHash(key)
+	m := uint32(len(f.bits) * 8)
+
+	for i := uint32(0); i < uint32(f.k); i++ {
+		pos := (h1 + i*h2) % m
+		f.bits[pos/8] |= 1 << (pos % 8)
+	}
+}
+
+// mayContain returns false if the key is definitely not part of the set.
+func (f *bloomFilter) mayContain(key []byte) bool {
+	if len(f.bits) == 0 {
+		return false
+	}
+
+	h1, h2 := bloomHash(key)
+	m := uint32(len(f.bits) * 8)
+
+	for i := uint32(0); i < uint32(f.k); i++ {
+		pos := (h1 + i*h2) % m
+		if f.bits[pos/8]&(1<<(pos%8)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func bloomHash(key []byte) (h1, h2 uint32) {
+	h := fnv.New64a()
+	h.Write(key)
+	sum := h.Sum64()
+
+	return uint32(sum), uint32(sum >> 32)
+}
+
+func (f *bloomFilter) MarshalBinary() (data []byte, err error) {
+	data = make([]byte, 1+len(f.bits))
+	data[0] = f.k
+	copy(data[1:], f.bits)
+
+	return data, nil
+}
+
+func (f *bloomFilter) UnmarshalBinary(data []byte) error {
+	if len(data) < 1 {
+		return errors.New("len(data) < 1")
+	}
+
+	f.k = data[0]
+	f.bits = data[1:]
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package sstable
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBloomFilter(t *testing.T) {
+	const n = 1000
+	const fpr = 0.01
+
+	f := newBloomFilter(n, fpr)
+	for i := 0; i < n; i++ {
+		f.add([]byte(fmt.Sprintf("key-%d", i)))
+	}
+
+	for i := 0; i < n; i++ {
+		if !f.mayContain([]byte(fmt.Sprintf("key-%d", i))) {
+			t.Fatalf("false negative for key-%d", i)
+		}
+	}
+
+	var falsePositives int
+	for i := 0; i < n; i++ {
+		if f.mayContain([]byte(fmt.Sprintf("other-%d", i))) {
+			falsePositives++
+		}
+	}
+
+	// Allow for some slack over the targeted rate.
+	if rate := float64(falsePositives) / n; rate > 3*fpr {
+		t.Fatalf("false positive rate too high: %f", rate)
+	}
+}
+
+func TestBloomFilterMarshal(t *testing.T) {
+	f := newBloomFilter(10, 0.01)
+	f.add([]byte("hello"))
+
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var g bloomFilter
+	if err := g.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if !g.mayContain([]byte("hello")) {
+		t.Fatal("expected unmarshaled filter to contain key")
+	}
+}
@@ -0,0 +1,90 @@
+package sstable
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// Iterator iterates over all entries of an SSTable in key order, including
+// tombstones. It reads one entry ahead, which can be inspected with Peek
+// before advancing to it.
+//
+//	it := t.NewIterator()
+//	for it.Next() {
+//		e := it.Entry()
+//		...
+//	}
+//	if err := it.Close(); err != nil {
+//		...
+//	}
+type Iterator struct {
+	r *bufio.Reader
+
+	cur entry
+	// next is the entry read ahead, it is only valid if hasNext is set.
+	next    entry
+	hasNext bool
+
+	// err is the error that stopped the iteration.
+	err error
+}
+
+// NewIterator returns an iterator that is positioned before the first entry
+// of the table.
+func (t *SSTable) NewIterator() *Iterator {
+	it := &Iterator{r: bufio.NewReader(t.data())}
+	it.readAhead()
+
+	return it
+}
+
+// Next advances the iterator to the next entry. It returns false once the
+// table is exhausted or reading fails.
+func (it *Iterator) Next() bool {
+	if !it.hasNext {
+		return false
+	}
+
+	it.cur = it.next
+	it.readAhead()
+
+	return true
+}
+
+// Entry returns the entry the iterator is positioned at.
+func (it *Iterator) Entry() entry {
+	return it.cur
+}
+
+// Peek returns the entry that the next call to Next advances to, without
+// advancing. It returns false if there is none.
+func (it *Iterator) Peek() (entry, bool) {
+	return it.next, it.hasNext
+}
+
+// Close stops the iteration. It returns the error that stopped the
+// iteration early, if any.
+func (it *Iterator) Close() error {
+	it.hasNext = false
+	it.next = entry{}
+
+	return it.err
+}
+
+func (it *Iterator) readAhead() {
+	e, err := readEntry(it.r)
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			it.err = err
+		}
+
+		it.hasNext = false
+		it.next = entry{}
+
+		return
+	}
+
+	it.next = e
+	it.hasNext = true
+}
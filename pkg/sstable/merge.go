@@ -0,0 +1,125 @@
+package sstable
+
+import (
+	"bytes"
+	"container/heap"
+	"fmt"
+)
+
+// MergeAll merges any number of tables into a new one with a k-way merge.
+// Tables are ordered from oldest to most recent. Of the entries of a key,
+// the one with the highest sequence number wins, ties are won by later
+// tables. Entries are streamed from the inputs to the result, only one entry
+// per table is held in memory. The caller must close the returned table,
+// the inputs are left open.
+//
+// Tombstones are only dropped from the result if final is true, i.e. if
+// there are no older tables left whose entries they'd need to shadow.
+func (m *SSTableManager) MergeAll(tables []*SSTable, final bool) (*SSTable, error) {
+	cursors := make(mergeHeap, 0, len(tables))
+	for i, t := range tables {
+		c := &mergeCursor{it: t.NewIterator(), age: i}
+		if _, ok := c.it.Peek(); ok {
+			cursors = append(cursors, c)
+		} else if err := c.it.Close(); err != nil {
+			return nil, fmt.Errorf("read table %d: %w", i, err)
+		}
+	}
+
+	heap.Init(&cursors)
+
+	n := 0
+	for _, t := range tables {
+		n += int(t.meta.EntryCount)
+	}
+
+	var last []byte
+	next := func() (entry, bool, error) {
+		for cursors.Len() > 0 {
+			c := cursors[0]
+			c.it.Next()
+			e := c.it.Entry()
+
+			if _, ok := c.it.Peek(); ok {
+				heap.Fix(&cursors, 0)
+			} else {
+				heap.Pop(&cursors)
+
+				if err := c.it.Close(); err != nil {
+					return entry{}, false, fmt.Errorf("read table %d: %w", c.age, err)
+				}
+			}
+
+			// The most recent entry of a key is popped first, skip
+			// the shadowed ones.
+			if last != nil && bytes.Equal(e.key, last) {
+				continue
+			}
+			last = e.key
+
+			if e.deleted && final {
+				continue
+			}
+
+			return e, true, nil
+		}
+
+		return entry{}, false, nil
+	}
+
+	t, err := m.newTable(n, next)
+	if err != nil {
+		return nil, fmt.Errorf("new table: %w", err)
+	}
+
+	return t, nil
+}
+
+// mergeCursor holds the iterator of a table during a merge. Its upcoming
+// entry is the one that will be merged next.
+type mergeCursor struct {
+	it *Iterator
+	// age is the position of the table in the merge, higher is more
+	// recent.
+	age int
+}
+
+// mergeHeap is a min-heap of cursors ordered by the key of their upcoming
+// entry. For equal keys, cursors with a higher sequence number and then
+// those of more recent tables come first. Only
+// cursors with an upcoming entry are kept on the heap.
+type mergeHeap []*mergeCursor
+
+var _ heap.Interface = &mergeHeap{}
+
+func (h mergeHeap) Len() int { return len(h) }
+
+func (h mergeHeap) Less(i, j int) bool {
+	ei, _ := h[i].it.Peek()
+	ej, _ := h[j].it.Peek()
+
+	switch bytes.Compare(ei.key, ej.key) {
+	case -1:
+		return true
+	case +1:
+		return false
+	}
+
+	if ei.seq != ej.seq {
+		return ei.seq > ej.seq
+	}
+
+	return h[i].age > h[j].age
+}
+
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *mergeHeap) Push(x any) { *h = append(*h, x.(*mergeCursor)) }
+
+func (h *mergeHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+
+	return c
+}
@@ -0,0 +1,85 @@
+package sstable
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Meta describes the entries of an SSTable.
+type Meta struct {
+	// MinKey and MaxKey are the smallest and largest key of the table,
+	// including deleted ones. Both are nil for empty tables.
+	MinKey, MaxKey []byte
+	// EntryCount is the number of entries, including tombstones.
+	EntryCount uint64
+	// MaxSeq is the highest sequence number of the entries.
+	MaxSeq uint64
+}
+
+var _ encoding.BinaryMarshaler = &Meta{}
+var _ encoding.BinaryUnmarshaler = &Meta{}
+
+// Contains reports whether key lies within the key range of the table. It
+// doesn't mean that the table contains the key.
+func (m Meta) Contains(key []byte) bool {
+	return m.EntryCount > 0 &&
+		bytes.Compare(m.MinKey, key) <= 0 &&
+		bytes.Compare(key, m.MaxKey) <= 0
+}
+
+// MarshalBinary encodes the metadata as
+//
+//	minKeySize (2B) | minKey | maxKeySize (2B) | maxKey | entryCount (8B) | maxSeq (8B)
+//
+// maxSeq was added later. Metadata without it decodes with a MaxSeq of 0,
+// which matches the tables written back then.
+func (m *Meta) MarshalBinary() (data []byte, err error) {
+	data = make([]byte, 20+len(m.MinKey)+len(m.MaxKey))
+
+	off := 0
+	for _, key := range [][]byte{m.MinKey, m.MaxKey} {
+		binary.BigEndian.PutUint16(data[off:], uint16(len(key)))
+		copy(data[off+2:], key)
+		off += 2 + len(key)
+	}
+
+	binary.BigEndian.PutUint64(data[off:], m.EntryCount)
+	binary.BigEndian.PutUint64(data[off+8:], m.MaxSeq)
+
+	return data, nil
+}
+
+func (m *Meta) UnmarshalBinary(data []byte) error {
+	var keys [2][]byte
+	for i := range keys {
+		if len(data) < 2 {
+			return errors.New("len(data) < 2")
+		}
+
+		keySize := int(binary.BigEndian.Uint16(data[:2]))
+		if len(data) < 2+keySize {
+			return fmt.Errorf("len(data) < len(key): %d < %d", len(data), 2+keySize)
+		}
+
+		if keySize > 0 {
+			keys[i] = data[2 : 2+keySize]
+		}
+		data = data[2+keySize:]
+	}
+
+	if len(data) < 8 {
+		return errors.New("len(data) < 8")
+	}
+
+	m.MinKey, m.MaxKey = keys[0], keys[1]
+	m.EntryCount = binary.BigEndian.Uint64(data[:8])
+	m.MaxSeq = 0
+	if len(data) >= 16 {
+		m.MaxSeq = binary.BigEndian.Uint64(data[8:16])
+	}
+
+	return nil
+}
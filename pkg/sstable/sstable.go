@@ -8,9 +8,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"iter"
 	"math"
 	"os"
+	"path/filepath"
 	"sort"
+	"sync/atomic"
 	"time"
 
 	"github.com/DerGut/zomdb/pkg/memtable"
@@ -19,71 +22,390 @@ import (
 
 var (
 	MaxKeySize = math.MaxUint16
-	MaxValSize = math.MaxUint32
+	MaxValSize = math.MaxUint32 - 1
+
+	// BloomFalsePositiveRate is the targeted false positive rate of the
+	// bloom filter stored alongside each SSTable.
+	BloomFalsePositiveRate = 0.01
+
+	// CompactionWindowSize is the maximum number of entry bytes a
+	// compaction holds in memory at once. Larger inputs are sorted in runs
+	// of this size, which are merged afterwards.
+	CompactionWindowSize = 64 << 20
+
+	// BlockSize is the targeted size of the blocks entries are grouped
+	// into. Blocks are the unit in which tables are read.
+	BlockSize = 4 << 10
 )
 
 var (
-	fs      = afero.NewOsFs()
-	timeSrc = func() time.Time { return time.Now() }
+	ErrNotFound = errors.New("not found")
+	ErrDeleted  = errors.New("deleted")
+)
+
+// tombstoneValSize is stored in place of the value size to mark an entry as
+// deleted.
+const tombstoneValSize = math.MaxUint32
+
+// formatVersion is the version of the file format, stored in the footer.
+// Version 2 added sequence numbers to entries.
+const formatVersion = 2
+
+// entryHeaderSize and entrySeqSize are the sizes of the fixed fields
+// surrounding the key and value of an entry.
+const (
+	entryHeaderSize = 6
+	entrySeqSize    = 8
 )
 
 // SSTable is an immutable structure of string sorted data
+//
+// On disk, the sorted entries are grouped into blocks of about BlockSize
+// bytes. The blocks are followed by a bloom filter over all keys, an index
+// of the blocks, the table's Meta and a fixed-size footer describing the
+// size of the sections:
+//
+//	| blocks | bloom filter | block index | meta | dataSize (8B) | filterSize (8B) | indexSize (8B) | metaSize (8B) | version (1B) |
+//
+// Each block starts with a header holding its entry count, size and
+// checksum. The block index holds the offset, size and first key of each
+// block.
 type SSTable struct {
 	file afero.File
+	size int64
+
+	dataSize int64
+	filter   *bloomFilter
+	index    []blockHandle
+	meta     Meta
 }
 
-// TODO: this needs some fs/ timeSrc
-func FromMemtable(mem *memtable.MemTable) (*SSTable, error) {
-	return nil, nil
+// SSTableManager creates SSTables on its filesystem.
+type SSTableManager struct {
+	fs          afero.Fs
+	dir         string
+	timeSrc     func() time.Time
+	compression CompressionType
+
+	// seq is appended to file names, so that tables created within the
+	// same second don't collide.
+	seq atomic.Uint64
 }
 
-// Compact creates a new immutable SSTable, and writes the result
-// of the compaction job there
-func (t *SSTable) Compact() (*SSTable, error) {
-	return compactFromReader(t.file)
+type SSTableManagerOptions struct {
+	// Dir is the directory tables are created in. Defaults to the root of
+	// the filesystem.
+	Dir string
+
+	// TimeSrc returns the time that new table files are named after.
+	// Defaults to time.Now.
+	TimeSrc func() time.Time
+
+	// Compression is the algorithm the blocks of new tables are compressed
+	// with. Defaults to CompressionNone.
+	Compression CompressionType
+}
+
+func NewSSTableManager(fs afero.Fs, opts SSTableManagerOptions) *SSTableManager {
+	if opts.TimeSrc == nil {
+		opts.TimeSrc = time.Now
+	}
+
+	return &SSTableManager{
+		fs:          fs,
+		dir:         opts.Dir,
+		timeSrc:     opts.TimeSrc,
+		compression: opts.Compression,
+	}
 }
 
-func Merge(a, b *SSTable) (*SSTable, error) {
-	r := io.MultiReader(a.file, b.file)
+// FromMemtable writes the content of the memtable to a new SSTable.
+// Deleted keys are written as tombstones. Each entry keeps the sequence
+// number of its write. The caller must close the returned table.
+func (m *SSTableManager) FromMemtable(mem *memtable.MemTable) (*SSTable, error) {
+	// Iterating a snapshot doesn't block writes to the memtable.
+	var entries []entry
+	for e := range mem.Snapshot().Entries() {
+		entries = append(entries, entry{key: e.Key, value: e.Value, deleted: e.Deleted, seq: e.Seq})
+	}
+
+	t, err := m.newFromEntries(entries)
+	if err != nil {
+		return nil, fmt.Errorf("new from entries: %w", err)
+	}
 
-	return compactFromReader(r)
+	return t, nil
 }
 
-func compactFromReader(r io.Reader) (*SSTable, error) {
-	res, err := compact(r)
+// Open loads an existing table file created by a manager. The caller must
+// close the returned table.
+func (m *SSTableManager) Open(name string) (*SSTable, error) {
+	f, err := m.fs.Open(name)
 	if err != nil {
-		return nil, fmt.Errorf("compact: %w", err)
+		return nil, fmt.Errorf("open file: %w", err)
 	}
 
-	t, err := newFromReader(res)
+	t, err := load(f)
 	if err != nil {
-		return nil, fmt.Errorf("new from reader: %w", err)
+		f.Close()
+		return nil, fmt.Errorf("load: %w", err)
 	}
 
 	return t, nil
 }
 
-func compact(r io.Reader) (*bytes.Buffer, error) {
-	entries, err := parseBuffered(r)
+// Name returns the name of the table's file.
+func (t *SSTable) Name() string {
+	return t.file.Name()
+}
+
+// Size returns the size of the table's file in bytes.
+func (t *SSTable) Size() int64 {
+	return t.size
+}
+
+// Meta returns the metadata of the table.
+func (t *SSTable) Meta() Meta {
+	return t.meta
+}
+
+// Get returns the value stored for key, or ErrNotFound if the table
+// doesn't contain the key. If the table contains a tombstone for the key,
+// ErrDeleted is returned instead.
+func (t *SSTable) Get(key []byte) ([]byte, error) {
+	return t.GetAt(key, math.MaxUint64)
+}
+
+// GetAt is like Get but only considers entries written at or before the
+// sequence number seq.
+//
+// A table only holds the most recent entry of each key. If that entry was
+// written after seq, GetAt returns ErrNotFound and older tables need to be
+// consulted instead.
+func (t *SSTable) GetAt(key []byte, seq uint64) ([]byte, error) {
+	if !t.filter.mayContain(key) {
+		return nil, ErrNotFound
+	}
+
+	i := t.blockFor(key)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+
+	entries, err := t.readBlock(i)
 	if err != nil {
-		return nil, fmt.Errorf("parse: %w", err)
+		return nil, err
 	}
 
-	compacted := compactEntries(entries)
+	// Keys are unique, so key can only be stored in this block.
+	r := bytes.NewReader(entries)
+	for {
+		e, err := readEntry(r)
+		if errors.Is(err, io.EOF) {
+			return nil, ErrNotFound
+		}
 
-	var out bytes.Buffer
-	for i := range compacted {
-		data, err := compacted[i].MarshalBinary()
 		if err != nil {
-			return nil, fmt.Errorf("marshal: %w", err)
+			return nil, fmt.Errorf("read entry: %w", err)
 		}
 
-		if _, err := out.Write(data); err != nil {
-			return nil, fmt.Errorf("write: %w", err)
+		switch bytes.Compare(e.key, key) {
+		case 0:
+			if e.seq > seq {
+				return nil, ErrNotFound
+			}
+
+			if e.deleted {
+				return nil, ErrDeleted
+			}
+
+			return e.value, nil
+		case +1:
+			// Entries are sorted, so we've already passed the key.
+			return nil, ErrNotFound
 		}
 	}
+}
 
-	return &out, nil
+// Scan returns an iterator over all entries with lo <= key <= hi in key
+// order. A nil lo starts at the first entry of the table, a nil hi ends at
+// its last entry. Deleted entries are skipped.
+//
+// If reading fails, the iteration stops and the returned function reports
+// the error. Each call to Scan tracks its own error, so concurrent scans
+// don't see each other's errors.
+func (t *SSTable) Scan(lo, hi []byte) (iter.Seq2[[]byte, []byte], func() error) {
+	var scanErr error
+
+	entries := func(yield func(k, v []byte) bool) {
+		scanErr = nil
+
+		start := 0
+		if lo != nil {
+			start = max(t.blockFor(lo), 0)
+		}
+
+		r := bufio.NewReader(t.blocks(start))
+		for {
+			e, err := readEntry(r)
+			if errors.Is(err, io.EOF) {
+				return
+			}
+
+			if err != nil {
+				scanErr = fmt.Errorf("read entry: %w", err)
+				return
+			}
+
+			if lo != nil && bytes.Compare(e.key, lo) < 0 {
+				continue
+			}
+
+			if hi != nil && bytes.Compare(e.key, hi) > 0 {
+				return
+			}
+
+			if e.deleted {
+				continue
+			}
+
+			if !yield(e.key, e.value) {
+				return
+			}
+		}
+	}
+
+	return entries, func() error { return scanErr }
+}
+
+// Compact creates a new immutable SSTable, and writes the result
+// of the compaction job there. The caller must close the returned table,
+// the input table is left open.
+//
+// Tombstones are only dropped from the result if final is true, i.e. if
+// there are no older tables left whose entries they'd need to shadow.
+func (m *SSTableManager) Compact(t *SSTable, final bool) (*SSTable, error) {
+	return m.compactFromReader(t.data(), final)
+}
+
+// Merge merges two tables into a new one. Entries of b are considered more
+// recent than those of a. The caller must close the returned table, the
+// inputs are left open.
+//
+// Tombstones are only dropped from the result if final is true, i.e. if
+// there are no older tables left whose entries they'd need to shadow.
+func (m *SSTableManager) Merge(a, b *SSTable, final bool) (*SSTable, error) {
+	r := io.MultiReader(a.data(), b.data())
+
+	return m.compactFromReader(r, final)
+}
+
+// data returns a reader over the entries of all blocks of the table.
+func (t *SSTable) data() io.Reader {
+	return t.blocks(0)
+}
+
+var _ io.Closer = &SSTable{}
+
+// Close releases the table's file handle. The table must not be used
+// afterwards.
+func (t *SSTable) Close() error {
+	return t.file.Close()
+}
+
+// Remove closes the table's file and deletes it. The table must not be used
+// afterwards.
+func (m *SSTableManager) Remove(t *SSTable) error {
+	name := t.file.Name()
+
+	if err := t.Close(); err != nil {
+		return fmt.Errorf("close: %w", err)
+	}
+
+	if err := m.fs.Remove(name); err != nil {
+		return fmt.Errorf("remove: %w", err)
+	}
+
+	return nil
+}
+
+// compactFromReader compacts the entries read from r into a new table
+// without holding more than CompactionWindowSize entry bytes in memory.
+//
+// Each window of entries is sorted and written to a temporary run table.
+// The runs are merged into the result and removed afterwards. Inputs that
+// fit into a single window are compacted in memory.
+func (m *SSTableManager) compactFromReader(r io.Reader, final bool) (t *SSTable, err error) {
+	br := bufio.NewReader(r)
+
+	var runs []*SSTable
+	defer func() {
+		for _, run := range runs {
+			if rerr := m.Remove(run); rerr != nil && err == nil {
+				err = fmt.Errorf("remove run: %w", rerr)
+			}
+		}
+	}()
+
+	for {
+		window, eof, err := readWindow(br, CompactionWindowSize)
+		if err != nil {
+			return nil, fmt.Errorf("read window: %w", err)
+		}
+
+		if eof && len(runs) == 0 {
+			t, err := m.newFromEntries(compactEntries(window, final))
+			if err != nil {
+				return nil, fmt.Errorf("new from entries: %w", err)
+			}
+
+			return t, nil
+		}
+
+		if len(window) > 0 {
+			// Runs keep their tombstones, they may shadow entries
+			// of earlier runs.
+			run, err := m.newFromEntries(compactEntries(window, false))
+			if err != nil {
+				return nil, fmt.Errorf("write run: %w", err)
+			}
+
+			runs = append(runs, run)
+		}
+
+		if eof {
+			break
+		}
+	}
+
+	t, err = m.MergeAll(runs, final)
+	if err != nil {
+		return nil, fmt.Errorf("merge runs: %w", err)
+	}
+
+	return t, nil
+}
+
+// readWindow reads entries from r until they add up to at least size bytes.
+// It reports whether r is exhausted.
+func readWindow(r io.Reader, size int) ([]entry, bool, error) {
+	var entries []entry
+	n := 0
+	for n < size {
+		e, err := readEntry(r)
+		if errors.Is(err, io.EOF) {
+			return entries, true, nil
+		}
+
+		if err != nil {
+			return nil, false, err
+		}
+
+		entries = append(entries, e)
+		n += e.size()
+	}
+
+	return entries, false, nil
 }
 
 func parseEntries(r io.Reader) ([]entry, error) {
@@ -108,9 +430,15 @@ func parseEntries(r io.Reader) ([]entry, error) {
 		keySize := binary.BigEndian.Uint16(sizeBuf[:2])
 		valSize := binary.BigEndian.Uint32(sizeBuf[2:])
 
+		deleted := valSize == tombstoneValSize
+		if deleted {
+			valSize = 0
+		}
+
 		// TODO: Preallocate buffer
 		key := make([]byte, keySize)
 		val := make([]byte, valSize)
+		seq := make([]byte, entrySeqSize)
 
 		if _, err := r.Read(key); err != nil {
 			return nil, fmt.Errorf("read key: %w", err)
@@ -120,9 +448,15 @@ func parseEntries(r io.Reader) ([]entry, error) {
 			return nil, fmt.Errorf("read val: %w", err)
 		}
 
+		if _, err := r.Read(seq); err != nil {
+			return nil, fmt.Errorf("read seq: %w", err)
+		}
+
 		entries = append(entries, entry{
-			key:   key,
-			value: val,
+			key:     key,
+			value:   val,
+			deleted: deleted,
+			seq:     binary.BigEndian.Uint64(seq),
 		})
 	}
 
@@ -132,14 +466,14 @@ func parseEntries(r io.Reader) ([]entry, error) {
 func parseBuffered(r io.Reader) ([]entry, error) {
 	br := bufio.NewReader(r)
 
-	buf := make([]byte, br.Size())
+	readBuf := make([]byte, br.Size())
 
 	var entries []entry
 	var overflow []byte
 
 	// Loop over entire file, filling buffer
 	for {
-		n, err := br.Read(buf)
+		n, err := br.Read(readBuf)
 		if err != nil && !errors.Is(err, io.EOF) {
 			return nil, fmt.Errorf("read: %w", err)
 		}
@@ -152,46 +486,58 @@ func parseBuffered(r io.Reader) ([]entry, error) {
 			return nil, errors.New("file is corrupt")
 		}
 
-		// Merge overflow from last iteration and buffer
-		// TODO: buffer size changes in size -> we read different window sizes
-		if len(overflow) > 0 {
-			buf = append(overflow, buf[:n]...)
-		} else {
-			buf = buf[:n]
-		}
+		// Merge overflow from last iteration and buffer. Parsed entries
+		// point into buf, so it must not be reused for the next read.
+		buf := append(overflow, readBuf[:n]...)
 
 		// Loop over entire buffer, parsing entries
-		var e entry
-		for off := 0; off < len(buf); {
+		off := 0
+		for off < len(buf) {
+			var e entry
 			if err := e.UnmarshalBinary(buf[off:]); err != nil {
-				// Not enough bytes to unmarshal, add to overflow
-				// and read next buffer window
-				overflow = append(overflow, buf[off:]...)
+				// Not enough bytes to unmarshal, keep the rest
+				// as overflow and read next buffer window
 				break
 			}
 
-			off += 6 + len(e.key) + len(e.value)
+			off += e.size()
 			entries = append(entries, e)
-			overflow = nil
 		}
+
+		overflow = buf[off:]
 	}
 
 	return entries, nil
 }
 
-func compactEntries(in []entry) []entry {
-	sort.Slice(in, func(i, j int) bool {
-		return bytes.Compare(in[i].key, in[j].key) < 0
+// compactEntries sorts the entries by key and only keeps the most recent
+// entry for each key, i.e. the one with the highest sequence number. Of
+// entries with the same sequence number, the last one in the input wins.
+//
+// Tombstones are kept unless dropTombstones is set.
+func compactEntries(in []entry, dropTombstones bool) []entry {
+	sort.SliceStable(in, func(i, j int) bool {
+		switch bytes.Compare(in[i].key, in[j].key) {
+		case -1:
+			return true
+		case +1:
+			return false
+		}
+
+		return in[i].seq < in[j].seq
 	})
 
 	var out []entry
-	var previousKey []byte
 	for i := range in {
-		if bytes.Equal(in[i].key, previousKey) {
+		if i+1 < len(in) && bytes.Equal(in[i].key, in[i+1].key) {
+			// A more recent entry for the same key follows.
+			continue
+		}
+
+		if in[i].deleted && dropTombstones {
 			continue
 		}
 
-		previousKey = in[i].key
 		out = append(out, in[i])
 	}
 
@@ -234,7 +580,7 @@ func compactBuffered(r io.Reader) (*bytes.Buffer, error) {
 
 			keySize := binary.BigEndian.Uint16(buf[off : off+2])
 			valSize := binary.BigEndian.Uint32(buf[off+2 : off+6])
-			entrySize := 6 + uint64(keySize) + uint64(valSize)
+			entrySize := entryHeaderSize + uint64(keySize) + uint64(valSize) + entrySeqSize
 
 			if windowSize < entrySize {
 				// TODO: save vars and wait for next buffer window
@@ -248,7 +594,7 @@ func compactBuffered(r io.Reader) (*bytes.Buffer, error) {
 			}
 
 			copy(e.key, buf[6:6+keySize])
-			copy(e.value, buf[6+keySize:entrySize])
+			copy(e.value, buf[6+keySize:entrySize-entrySeqSize])
 
 			m[string(e.key)] = e.value
 			keys = append(keys, e.key)
@@ -279,40 +625,165 @@ func compactBuffered(r io.Reader) (*bytes.Buffer, error) {
 	return &out, nil
 }
 
-func newFromReader(r io.Reader) (*SSTable, error) {
-	name := newFilename()
+func (m *SSTableManager) newFromEntries(entries []entry) (*SSTable, error) {
+	return m.newTable(len(entries), sliceEntries(entries))
+}
 
-	f, err := newFile(name)
+// newTable writes the entries returned by next to a new table. n is an
+// upper bound of the number of entries and sizes the table's bloom filter.
+func (m *SSTableManager) newTable(n int, next nextEntry) (*SSTable, error) {
+	f, err := m.newFile()
 	if err != nil {
 		return nil, fmt.Errorf("new file: %w", err)
 	}
 
-	if err := writeFile(f, r); err != nil {
+	if err := writeFile(f, m.compression, n, next); err != nil {
+		m.discard(f)
 		return nil, fmt.Errorf("write file: %w", err)
 	}
 
+	t, err := load(f)
+	if err != nil {
+		m.discard(f)
+		return nil, fmt.Errorf("load: %w", err)
+	}
+
+	return t, nil
+}
+
+// discard closes and removes the file of a table that couldn't be created.
+func (m *SSTableManager) discard(f afero.File) {
+	f.Close()
+	m.fs.Remove(f.Name())
+}
+
+// nextEntry returns the next entry of a sequence. It returns false once the
+// sequence is exhausted.
+type nextEntry func() (entry, bool, error)
+
+func sliceEntries(entries []entry) nextEntry {
+	return func() (entry, bool, error) {
+		if len(entries) == 0 {
+			return entry{}, false, nil
+		}
+
+		e := entries[0]
+		entries = entries[1:]
+
+		return e, true, nil
+	}
+}
+
+// load reads the footer and bloom filter of an SSTable file.
+func load(f afero.File) (*SSTable, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("stat: %w", err)
+	}
+
+	size := info.Size()
+	if size < footerSize {
+		return nil, fmt.Errorf("file size < footer size: %d < %d", size, footerSize)
+	}
+
+	buf := make([]byte, footerSize)
+	if _, err := f.ReadAt(buf, size-footerSize); err != nil {
+		return nil, fmt.Errorf("read footer: %w", err)
+	}
+
+	var ft footer
+	if err := ft.UnmarshalBinary(buf); err != nil {
+		return nil, fmt.Errorf("unmarshal footer: %w", err)
+	}
+
+	if ft.version != formatVersion {
+		return nil, fmt.Errorf("unsupported format version %d", ft.version)
+	}
+
+	if ft.dataSize+ft.filterSize+ft.indexSize+ft.metaSize+footerSize != size {
+		return nil, errors.New("file is corrupt: footer doesn't match file size")
+	}
+
+	buf = make([]byte, ft.filterSize)
+	if _, err := f.ReadAt(buf, ft.dataSize); err != nil {
+		return nil, fmt.Errorf("read filter: %w", err)
+	}
+
+	var filter bloomFilter
+	if err := filter.UnmarshalBinary(buf); err != nil {
+		return nil, fmt.Errorf("unmarshal filter: %w", err)
+	}
+
+	buf = make([]byte, ft.indexSize)
+	if _, err := f.ReadAt(buf, ft.dataSize+ft.filterSize); err != nil {
+		return nil, fmt.Errorf("read index: %w", err)
+	}
+
+	var index []blockHandle
+	for len(buf) > 0 {
+		var h blockHandle
+		if err := h.UnmarshalBinary(buf); err != nil {
+			return nil, fmt.Errorf("unmarshal index: %w", err)
+		}
+
+		index = append(index, h)
+		buf = buf[14+len(h.firstKey):]
+	}
+
+	buf = make([]byte, ft.metaSize)
+	if _, err := f.ReadAt(buf, ft.dataSize+ft.filterSize+ft.indexSize); err != nil {
+		return nil, fmt.Errorf("read meta: %w", err)
+	}
+
+	var meta Meta
+	if err := meta.UnmarshalBinary(buf); err != nil {
+		return nil, fmt.Errorf("unmarshal meta: %w", err)
+	}
+
 	return &SSTable{
-		file: f,
+		file:     f,
+		size:     size,
+		dataSize: ft.dataSize,
+		filter:   &filter,
+		index:    index,
+		meta:     meta,
 	}, nil
 }
 
-func newFilename() string {
-	now := timeSrc()
-	return now.Format(time.RFC3339)
+// newFilename returns a unique name for a new table file in the manager's
+// directory.
+func (m *SSTableManager) newFilename() string {
+	now := m.timeSrc()
+	seq := m.seq.Add(1)
+
+	return filepath.Join(m.dir, fmt.Sprintf("%s-%08d.sst", now.Format(time.RFC3339), seq))
 }
 
-func newFile(name string) (afero.File, error) {
-	f, err := fs.OpenFile(name, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0655)
-	if err != nil {
-		return nil, fmt.Errorf("open file: %w", err)
+// newFile creates the file of a new table. It never overwrites another
+// table: if the name is taken, e.g. by a table that a previous manager
+// created within the same second, it moves on to the next one.
+func (m *SSTableManager) newFile() (afero.File, error) {
+	if err := m.fs.MkdirAll(m.dir, 0755); err != nil {
+		return nil, fmt.Errorf("create dir: %w", err)
 	}
 
-	return f, nil
+	for {
+		f, err := m.fs.OpenFile(m.newFilename(), os.O_CREATE|os.O_EXCL|os.O_RDWR|os.O_APPEND, 0655)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("open file: %w", err)
+		}
+
+		return f, nil
+	}
 }
 
-func writeFile(f afero.File, r io.Reader) error {
-	if err := writeBuffered(f, r); err != nil {
-		return fmt.Errorf("write buffered: %w", err)
+func writeFile(f afero.File, compression CompressionType, n int, next nextEntry) error {
+	if err := writeTable(f, compression, n, next); err != nil {
+		return fmt.Errorf("write table: %w", err)
 	}
 
 	if err := f.Sync(); err != nil {
@@ -322,11 +793,96 @@ func writeFile(f afero.File, r io.Reader) error {
 	return nil
 }
 
-func writeBuffered(w io.Writer, r io.Reader) error {
+// writeTable writes the entries in their given order grouped into blocks,
+// followed by a bloom filter over their keys, the block index, the table's
+// Meta and the footer. The filter is sized for n entries and the blocks are
+// compressed with the given algorithm.
+func writeTable(w io.Writer, compression CompressionType, n int, next nextEntry) error {
 	buf := bufio.NewWriter(w)
+	blocks := blockWriter{w: buf, compression: compression}
+
+	filter := newBloomFilter(n, BloomFalsePositiveRate)
+
+	var ft footer
+	var meta Meta
+	for {
+		e, ok, err := next()
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			break
+		}
 
-	if err := writeAll(buf, r, buf.Size()); err != nil {
-		return fmt.Errorf("writeAll: %w", err)
+		data, err := e.MarshalBinary()
+		if err != nil {
+			return fmt.Errorf("marshal: %w", err)
+		}
+
+		if err := blocks.add(e.key, data); err != nil {
+			return err
+		}
+
+		filter.add(e.key)
+
+		if meta.EntryCount == 0 {
+			meta.MinKey = e.key
+		}
+		meta.MaxKey = e.key
+		meta.EntryCount++
+		meta.MaxSeq = max(meta.MaxSeq, e.seq)
+	}
+
+	if err := blocks.flush(); err != nil {
+		return err
+	}
+
+	ft.dataSize = blocks.off
+
+	data, err := filter.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("marshal filter: %w", err)
+	}
+
+	if _, err := buf.Write(data); err != nil {
+		return fmt.Errorf("write filter: %w", err)
+	}
+
+	ft.filterSize = int64(len(data))
+
+	for i := range blocks.handles {
+		data, err := blocks.handles[i].MarshalBinary()
+		if err != nil {
+			return fmt.Errorf("marshal index: %w", err)
+		}
+
+		if _, err := buf.Write(data); err != nil {
+			return fmt.Errorf("write index: %w", err)
+		}
+
+		ft.indexSize += int64(len(data))
+	}
+
+	data, err = meta.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("marshal meta: %w", err)
+	}
+
+	if _, err := buf.Write(data); err != nil {
+		return fmt.Errorf("write meta: %w", err)
+	}
+
+	ft.metaSize = int64(len(data))
+	ft.version = formatVersion
+
+	data, err = ft.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("marshal footer: %w", err)
+	}
+
+	if _, err := buf.Write(data); err != nil {
+		return fmt.Errorf("write footer: %w", err)
 	}
 
 	if err := buf.Flush(); err != nil {
@@ -336,29 +892,96 @@ func writeBuffered(w io.Writer, r io.Reader) error {
 	return nil
 }
 
-func writeAll(w io.Writer, r io.Reader, bufSize int) error {
-	buf := make([]byte, bufSize)
+const footerSize = 33
 
-	for {
-		n, err := r.Read(buf)
-		if err != nil && !errors.Is(err, io.EOF) {
-			return fmt.Errorf("read: %w", err)
-		}
+// footer is stored at the end of each SSTable file and describes the sizes
+// of the sections preceding it and the version of the file format.
+type footer struct {
+	dataSize   int64
+	filterSize int64
+	indexSize  int64
+	metaSize   int64
+	version    uint8
+}
 
-		if n == 0 {
-			break
-		}
+func (f *footer) MarshalBinary() (data []byte, err error) {
+	data = make([]byte, footerSize)
 
-		if _, err := w.Write(buf[:n]); err != nil {
-			return fmt.Errorf("write: %w", err)
-		}
+	binary.BigEndian.PutUint64(data[:8], uint64(f.dataSize))
+	binary.BigEndian.PutUint64(data[8:16], uint64(f.filterSize))
+	binary.BigEndian.PutUint64(data[16:24], uint64(f.indexSize))
+	binary.BigEndian.PutUint64(data[24:32], uint64(f.metaSize))
+	data[32] = f.version
+
+	return data, nil
+}
+
+func (f *footer) UnmarshalBinary(data []byte) error {
+	if len(data) < footerSize {
+		return fmt.Errorf("len(data) < footerSize: %d < %d", len(data), footerSize)
 	}
 
+	f.dataSize = int64(binary.BigEndian.Uint64(data[:8]))
+	f.filterSize = int64(binary.BigEndian.Uint64(data[8:16]))
+	f.indexSize = int64(binary.BigEndian.Uint64(data[16:24]))
+	f.metaSize = int64(binary.BigEndian.Uint64(data[24:32]))
+	f.version = data[32]
+
 	return nil
 }
 
+// entry is a key-value pair as it is stored in a table:
+//
+//	keySize (2B) | valSize (4B) | key | value | seq (8B)
 type entry struct {
 	key, value []byte
+
+	// deleted marks the entry as a tombstone, it doesn't have a value.
+	deleted bool
+
+	// seq is the sequence number the entry was written at. Higher is more
+	// recent.
+	seq uint64
+}
+
+// size returns the number of bytes of the encoded entry.
+func (e *entry) size() int {
+	return entryHeaderSize + len(e.key) + len(e.value) + entrySeqSize
+}
+
+// readEntry reads the next entry from r. It returns io.EOF if r is exhausted
+// right at an entry boundary.
+func readEntry(r io.Reader) (entry, error) {
+	header := make([]byte, entryHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return entry{}, err
+	}
+
+	keySize := binary.BigEndian.Uint16(header[:2])
+	valSize := binary.BigEndian.Uint32(header[2:6])
+
+	deleted := valSize == tombstoneValSize
+	if deleted {
+		valSize = 0
+	}
+
+	data := make([]byte, uint64(keySize)+uint64(valSize)+entrySeqSize)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return entry{}, err
+	}
+
+	seqOff := uint64(keySize) + uint64(valSize)
+
+	return entry{
+		key:     data[:keySize],
+		value:   data[keySize:seqOff],
+		deleted: deleted,
+		seq:     binary.BigEndian.Uint64(data[seqOff:]),
+	}, nil
 }
 
 var _ encoding.BinaryMarshaler = &entry{}
@@ -373,30 +996,43 @@ func (e *entry) MarshalBinary() (data []byte, err error) {
 		return nil, errors.New("len(value) > MaxValSize")
 	}
 
-	data = make([]byte, 6+len(e.key)+len(e.value))
+	valSize := uint32(len(e.value))
+	if e.deleted {
+		valSize = tombstoneValSize
+	}
+
+	data = make([]byte, e.size())
 
 	binary.BigEndian.PutUint16(data[:2], uint16(len(e.key)))
-	binary.BigEndian.PutUint32(data[2:6], uint32(len(e.value)))
-	copy(data[6:6+len(e.key)], e.key)
+	binary.BigEndian.PutUint32(data[2:6], valSize)
+	copy(data[6:], e.key)
 	copy(data[6+len(e.key):], e.value)
+	binary.BigEndian.PutUint64(data[len(data)-entrySeqSize:], e.seq)
 
 	return data, nil
 }
 
 func (e *entry) UnmarshalBinary(data []byte) error {
-	if len(data) < 6 {
-		return errors.New("len(data) < 6")
+	if len(data) < entryHeaderSize {
+		return errors.New("len(data) < entryHeaderSize")
 	}
 
-	keySize := binary.BigEndian.Uint16(data[:2])
-	valSize := binary.BigEndian.Uint32(data[2:6])
+	keySize := uint64(binary.BigEndian.Uint16(data[:2]))
+	valSize := uint64(binary.BigEndian.Uint32(data[2:6]))
+
+	e.deleted = valSize == tombstoneValSize
+	if e.deleted {
+		valSize = 0
+	}
 
-	if uint64(len(data)) < 6+uint64(keySize)+uint64(valSize) {
-		return fmt.Errorf("len(data) < len(entry): %d < %d", len(data), 6+uint64(keySize)+uint64(valSize))
+	size := entryHeaderSize + keySize + valSize + entrySeqSize
+	if uint64(len(data)) < size {
+		return fmt.Errorf("len(data) < len(entry): %d < %d", len(data), size)
 	}
 
-	e.key = data[6 : 6+uint32(keySize)]
-	e.value = data[6+keySize : 6+uint64(keySize)+uint64(valSize)]
+	e.key = data[6 : 6+keySize]
+	e.value = data[6+keySize : 6+keySize+valSize]
+	e.seq = binary.BigEndian.Uint64(data[6+keySize+valSize : size])
 
 	return nil
 }
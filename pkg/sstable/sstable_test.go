@@ -2,12 +2,17 @@ package sstable
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
 	"os"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/DerGut/zomdb/pkg/memtable"
 	"github.com/spf13/afero"
 )
 
@@ -18,8 +23,9 @@ func BenchmarkCompactInMem(b *testing.B) {
 
 	tmpDir := b.TempDir()
 
-	// TODO: This uses the global fs var
-	fs = afero.NewBasePathFs(afero.NewOsFs(), tmpDir)
+	fs := afero.NewBasePathFs(afero.NewOsFs(), tmpDir)
+
+	m := NewSSTableManager(fs, SSTableManagerOptions{})
 
 	rnd := rand.New(rand.NewSource(10))
 
@@ -28,7 +34,7 @@ func BenchmarkCompactInMem(b *testing.B) {
 
 	for i := 0; i < b.N; i++ {
 		filename := fmt.Sprintf("sstable-%d", i)
-		err := prepareFile(filename, rnd, keySize, valSize, tableSize)
+		err := prepareFile(fs, filename, rnd, keySize, valSize, tableSize)
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -38,11 +44,14 @@ func BenchmarkCompactInMem(b *testing.B) {
 			b.Fatal(err)
 		}
 
-		sst := SSTable{file: f}
+		sst, err := load(f)
+		if err != nil {
+			b.Fatal(err)
+		}
 
 		b.StartTimer()
 
-		result, err := sst.Compact()
+		result, err := m.Compact(sst, false)
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -58,7 +67,7 @@ func BenchmarkCompactInMem(b *testing.B) {
 	}
 }
 
-func prepareFile(name string, rnd *rand.Rand, keySize, valSize, tableSize int) error {
+func prepareFile(fs afero.Fs, name string, rnd *rand.Rand, keySize, valSize, tableSize int) error {
 	f, err := fs.OpenFile(name, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0655)
 	if err != nil {
 		return err
@@ -78,27 +87,17 @@ func prepareFile(name string, rnd *rand.Rand, keySize, valSize, tableSize int) e
 		return err
 	}
 
-	data, err := e.MarshalBinary()
-	if err != nil {
-		return err
-	}
-
-	for i := 0; i < tableSize; i++ {
-		if _, err := f.Write(data); err != nil {
-			return err
-		}
-	}
-
-	if err := f.Sync(); err != nil {
-		return err
+	entries := make([]entry, tableSize)
+	for i := range entries {
+		entries[i] = e
 	}
 
-	return nil
+	return writeFile(f, CompressionNone, len(entries), sliceEntries(entries))
 }
 
 func FuzzEntry(f *testing.F) {
 	f.Fuzz(func(t *testing.T, key, value []byte) {
-		e := entry{key, value}
+		e := entry{key: key, value: value}
 
 		data, err := e.MarshalBinary()
 		if err != nil {
@@ -178,6 +177,34 @@ func TestParseEntries(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "distinct entries across buffer windows",
+			entries: []entry{
+				{
+					key:   bytes.Repeat([]byte("a"), 1500),
+					value: bytes.Repeat([]byte("1"), 1500),
+				},
+				{
+					key:   bytes.Repeat([]byte("b"), 1500),
+					value: bytes.Repeat([]byte("2"), 1500),
+				},
+				{
+					key:   bytes.Repeat([]byte("c"), 1500),
+					value: bytes.Repeat([]byte("3"), 1500),
+				},
+			},
+		},
+		{
+			name: "entry spans multiple buffer windows",
+			entries: []entry{
+				{key: []byte("before"), value: []byte("1")},
+				{
+					key:   bytes.Repeat([]byte("k"), 5000),
+					value: bytes.Repeat([]byte("v"), 10000),
+				},
+				{key: []byte("after"), value: []byte("2")},
+			},
+		},
 		{
 			name: "key is longer than buffer",
 			entries: []entry{
@@ -236,6 +263,682 @@ func TestParseEntries(t *testing.T) {
 	}
 }
 
+func TestManagerDir(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	// All tables are created within the same second.
+	now := time.Now()
+	m := NewSSTableManager(fs, SSTableManagerOptions{
+		Dir:     "tables",
+		TimeSrc: func() time.Time { return now },
+	})
+
+	for range 2 {
+		if _, err := m.newFromEntries([]entry{{key: []byte("a"), value: []byte("1")}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := afero.ReadDir(fs, "tables")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(files))
+	}
+}
+
+func TestNewTableError(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	m := NewSSTableManager(fs, SSTableManagerOptions{Dir: "tables"})
+
+	entries := sliceEntries([]entry{{key: []byte("a"), value: []byte("1")}})
+	failing := func() (entry, bool, error) {
+		e, ok, err := entries()
+		if !ok {
+			return entry{}, false, errors.New("read failed")
+		}
+
+		return e, ok, err
+	}
+
+	if _, err := m.newTable(1, failing); err == nil {
+		t.Fatal("expected newTable to fail")
+	}
+
+	// The half-written file is removed.
+	files, err := afero.ReadDir(fs, "tables")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 0 {
+		t.Fatalf("expected no files, got %d", len(files))
+	}
+}
+
+func TestGet(t *testing.T) {
+	m := NewSSTableManager(afero.NewMemMapFs(), SSTableManagerOptions{})
+
+	sst, err := m.newFromEntries([]entry{
+		{key: []byte("a"), value: []byte("1")},
+		{key: []byte("b"), value: []byte("2")},
+		{key: []byte("d"), value: []byte("4")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := sst.Get([]byte("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(value, []byte("2")) {
+		t.Fatalf("expected %q, got %q", "2", value)
+	}
+
+	for _, key := range []string{"c", "e", ""} {
+		if _, err := sst.Get([]byte(key)); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("get %q: expected ErrNotFound, got %v", key, err)
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	m := NewSSTableManager(afero.NewMemMapFs(), SSTableManagerOptions{})
+
+	sst, err := m.newFromEntries([]entry{
+		{key: []byte("a"), value: []byte("1")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sst.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sst.Get([]byte("a")); err == nil {
+		t.Fatal("expected get on closed table to fail")
+	}
+}
+
+func TestScan(t *testing.T) {
+	m := NewSSTableManager(afero.NewMemMapFs(), SSTableManagerOptions{})
+
+	sst, err := m.newFromEntries([]entry{
+		{key: []byte("a"), value: []byte("1")},
+		{key: []byte("b"), value: []byte("2")},
+		{key: []byte("c"), deleted: true},
+		{key: []byte("d"), value: []byte("4")},
+		{key: []byte("e"), value: []byte("5")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tc := []struct {
+		name   string
+		lo, hi []byte
+		keys   string
+	}{
+		{name: "all", keys: "abde"},
+		{name: "from lo", lo: []byte("b"), keys: "bde"},
+		{name: "until hi", hi: []byte("bb"), keys: "ab"},
+		{name: "range", lo: []byte("aa"), hi: []byte("d"), keys: "bd"},
+		{name: "empty", lo: []byte("f"), keys: ""},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var keys string
+			entries, errFn := sst.Scan(tt.lo, tt.hi)
+			for k := range entries {
+				keys += string(k)
+			}
+
+			if err := errFn(); err != nil {
+				t.Fatal(err)
+			}
+
+			if keys != tt.keys {
+				t.Fatalf("expected keys %q, got %q", tt.keys, keys)
+			}
+		})
+	}
+}
+
+func TestFromMemtable(t *testing.T) {
+	m := NewSSTableManager(afero.NewMemMapFs(), SSTableManagerOptions{})
+
+	var mem memtable.MemTable
+	for _, key := range []string{"b", "c", "a"} {
+		if err := mem.Put([]byte(key), []byte("v"+key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := mem.Delete([]byte("b")); err != nil {
+		t.Fatal(err)
+	}
+
+	sst, err := m.FromMemtable(&mem)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keys string
+	entries, errFn := sst.Scan(nil, nil)
+	for k := range entries {
+		keys += string(k)
+	}
+
+	if err := errFn(); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys != "ac" {
+		t.Fatalf("expected keys %q, got %q", "ac", keys)
+	}
+
+	if _, err := sst.Get([]byte("b")); !errors.Is(err, ErrDeleted) {
+		t.Fatalf("expected ErrDeleted, got %v", err)
+	}
+
+	value, err := sst.Get([]byte("c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(value, []byte("vc")) {
+		t.Fatalf("expected %q, got %q", "vc", value)
+	}
+}
+
+func TestMeta(t *testing.T) {
+	// Tables are named after the current time, make sure they don't
+	// collide.
+	m := NewSSTableManager(afero.NewMemMapFs(), SSTableManagerOptions{})
+
+	sst, err := m.newFromEntries([]entry{
+		{key: []byte("b"), value: []byte("1")},
+		{key: []byte("c"), value: []byte("2")},
+		{key: []byte("e"), deleted: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta := sst.Meta()
+	if string(meta.MinKey) != "b" || string(meta.MaxKey) != "e" || meta.EntryCount != 3 {
+		t.Fatalf("expected meta {b e 3}, got {%s %s %d}", meta.MinKey, meta.MaxKey, meta.EntryCount)
+	}
+
+	for key, contains := range map[string]bool{"a": false, "b": true, "d": true, "e": true, "ee": false} {
+		if meta.Contains([]byte(key)) != contains {
+			t.Fatalf("contains %q: expected %t", key, contains)
+		}
+	}
+
+	empty, err := m.newFromEntries(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if meta := empty.Meta(); meta.EntryCount != 0 || meta.Contains(nil) {
+		t.Fatalf("expected empty meta, got %v", meta)
+	}
+}
+
+func TestGetDeleted(t *testing.T) {
+	m := NewSSTableManager(afero.NewMemMapFs(), SSTableManagerOptions{})
+
+	sst, err := m.newFromEntries([]entry{
+		{key: []byte("a"), value: []byte("1")},
+		{key: []byte("b"), deleted: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sst.Get([]byte("b")); !errors.Is(err, ErrDeleted) {
+		t.Fatalf("expected ErrDeleted, got %v", err)
+	}
+}
+
+func TestTombstone(t *testing.T) {
+	e := entry{key: []byte("key"), deleted: true}
+
+	data, err := e.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b entry
+	if err := b.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if !b.deleted {
+		t.Fatal("expected entry to be deleted")
+	}
+
+	if !bytes.Equal(b.key, e.key) {
+		t.Fatalf("expected key %q, got %q", e.key, b.key)
+	}
+
+	entries, err := parseEntries(bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || !entries[0].deleted {
+		t.Fatalf("expected a single tombstone, got %v", entries)
+	}
+}
+
+func TestCompactEntries(t *testing.T) {
+	in := func() []entry {
+		return []entry{
+			{key: []byte("b"), value: []byte("1")},
+			{key: []byte("a"), value: []byte("1")},
+			{key: []byte("b"), deleted: true},
+			{key: []byte("a"), value: []byte("2")},
+		}
+	}
+
+	t.Run("keep tombstones", func(t *testing.T) {
+		compareEntries(t, []entry{
+			{key: []byte("a"), value: []byte("2")},
+			{key: []byte("b"), deleted: true},
+		}, compactEntries(in(), false))
+	})
+
+	t.Run("drop tombstones", func(t *testing.T) {
+		compareEntries(t, []entry{
+			{key: []byte("a"), value: []byte("2")},
+		}, compactEntries(in(), true))
+	})
+}
+
+func TestIterator(t *testing.T) {
+	m := NewSSTableManager(afero.NewMemMapFs(), SSTableManagerOptions{})
+
+	in := []entry{
+		{key: []byte("a"), value: []byte("1")},
+		{key: []byte("b"), deleted: true},
+		{key: []byte("c"), value: []byte("3")},
+	}
+
+	sst, err := m.newFromEntries(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	it := sst.NewIterator()
+
+	if e, ok := it.Peek(); !ok || !bytes.Equal(e.key, []byte("a")) {
+		t.Fatalf("expected to peek %q, got %q, %t", "a", e.key, ok)
+	}
+
+	var entries []entry
+	for it.Next() {
+		e := it.Entry()
+		entries = append(entries, e)
+
+		// Peeking doesn't advance the iterator.
+		it.Peek()
+		if !bytes.Equal(it.Entry().key, e.key) {
+			t.Fatalf("expected entry %q after peek, got %q", e.key, it.Entry().key)
+		}
+	}
+
+	if err := it.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	compareEntries(t, in, entries)
+
+	if _, ok := it.Peek(); ok {
+		t.Fatal("expected no entry to peek at the end")
+	}
+}
+
+func TestSeq(t *testing.T) {
+	m := NewSSTableManager(afero.NewMemMapFs(), SSTableManagerOptions{})
+
+	// The higher sequence number wins regardless of the input order.
+	entries := compactEntries([]entry{
+		{key: []byte("a"), value: []byte("2"), seq: 2},
+		{key: []byte("a"), value: []byte("1"), seq: 1},
+		{key: []byte("b"), value: []byte("3"), seq: 3},
+	}, false)
+
+	compareEntries(t, []entry{
+		{key: []byte("a"), value: []byte("2"), seq: 2},
+		{key: []byte("b"), value: []byte("3"), seq: 3},
+	}, entries)
+
+	older, err := m.newFromEntries(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newer, err := m.newFromEntries([]entry{
+		{key: []byte("a"), value: []byte("1"), seq: 1},
+		{key: []byte("b"), deleted: true, seq: 4},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merged, err := m.MergeAll([]*SSTable{older, newer}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	it := merged.NewIterator()
+	var got []entry
+	for it.Next() {
+		got = append(got, it.Entry())
+	}
+
+	if err := it.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	compareEntries(t, []entry{
+		{key: []byte("a"), value: []byte("2"), seq: 2},
+		{key: []byte("b"), deleted: true, seq: 4},
+	}, got)
+
+	if value, err := merged.GetAt([]byte("a"), 2); err != nil || !bytes.Equal(value, []byte("2")) {
+		t.Fatalf("expected %q, got %q, %v", "2", value, err)
+	}
+
+	if _, err := merged.GetAt([]byte("a"), 1); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound before the entry was written, got %v", err)
+	}
+
+	if _, err := merged.GetAt([]byte("b"), 4); !errors.Is(err, ErrDeleted) {
+		t.Fatalf("expected ErrDeleted, got %v", err)
+	}
+}
+
+func TestMergeAll(t *testing.T) {
+	// Tables are named after the current time, make sure they don't
+	// collide.
+	m := NewSSTableManager(afero.NewMemMapFs(), SSTableManagerOptions{})
+
+	var tables []*SSTable
+	for _, entries := range [][]entry{
+		{
+			{key: []byte("a"), value: []byte("1")},
+			{key: []byte("b"), value: []byte("1")},
+			{key: []byte("d"), value: []byte("1")},
+		},
+		{
+			{key: []byte("b"), value: []byte("2")},
+			{key: []byte("c"), value: []byte("2")},
+			{key: []byte("d"), deleted: true},
+		},
+		{
+			{key: []byte("a"), value: []byte("3")},
+			{key: []byte("e"), value: []byte("3")},
+		},
+	} {
+		sst, err := m.newFromEntries(entries)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tables = append(tables, sst)
+	}
+
+	t.Run("keep tombstones", func(t *testing.T) {
+		merged, err := m.MergeAll(tables, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entries, err := parseBuffered(merged.data())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		compareEntries(t, []entry{
+			{key: []byte("a"), value: []byte("3")},
+			{key: []byte("b"), value: []byte("2")},
+			{key: []byte("c"), value: []byte("2")},
+			{key: []byte("d"), deleted: true},
+			{key: []byte("e"), value: []byte("3")},
+		}, entries)
+	})
+
+	t.Run("drop tombstones", func(t *testing.T) {
+		merged, err := m.MergeAll(tables, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entries, err := parseBuffered(merged.data())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		compareEntries(t, []entry{
+			{key: []byte("a"), value: []byte("3")},
+			{key: []byte("b"), value: []byte("2")},
+			{key: []byte("c"), value: []byte("2")},
+			{key: []byte("e"), value: []byte("3")},
+		}, entries)
+	})
+}
+
+func TestCompactInRuns(t *testing.T) {
+	windowSize := CompactionWindowSize
+	t.Cleanup(func() { CompactionWindowSize = windowSize })
+
+	// Fits about three entries per window.
+	CompactionWindowSize = 30
+
+	fs := afero.NewMemMapFs()
+	m := NewSSTableManager(fs, SSTableManagerOptions{})
+
+	in := []entry{
+		{key: []byte("d"), value: []byte("1")},
+		{key: []byte("b"), value: []byte("1")},
+		{key: []byte("a"), value: []byte("1")},
+		{key: []byte("c"), value: []byte("1")},
+		{key: []byte("b"), deleted: true},
+		{key: []byte("a"), value: []byte("2")},
+		{key: []byte("e"), deleted: true},
+		{key: []byte("d"), value: []byte("2")},
+	}
+
+	// Write the entries unsorted, like a table that still needs
+	// compaction.
+	sst, err := m.newFromEntries(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, final := range []bool{false, true} {
+		t.Run(fmt.Sprintf("final=%t", final), func(t *testing.T) {
+			result, err := m.Compact(sst, final)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := parseBuffered(result.data())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			compareEntries(t, compactEntries(slices.Clone(in), final), entries)
+
+			// Only the input and the result are left, all runs are
+			// removed.
+			files, err := afero.ReadDir(fs, "/")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(files) != 2 {
+				t.Fatalf("expected 2 files, got %d", len(files))
+			}
+
+			if err := m.Remove(result); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestBlocks(t *testing.T) {
+	blockSize := BlockSize
+	t.Cleanup(func() { BlockSize = blockSize })
+
+	// Fits about two entries per block.
+	BlockSize = 20
+
+	fs := afero.NewMemMapFs()
+	m := NewSSTableManager(fs, SSTableManagerOptions{})
+
+	var entries []entry
+	for i := range 100 {
+		entries = append(entries, entry{
+			key:   []byte(fmt.Sprintf("key%03d", i)),
+			value: []byte(fmt.Sprintf("v%d", i)),
+		})
+	}
+
+	sst, err := m.newFromEntries(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sst.index) < 10 {
+		t.Fatalf("expected the table to span many blocks, got %d", len(sst.index))
+	}
+
+	for _, e := range entries {
+		value, err := sst.Get(e.key)
+		if err != nil {
+			t.Fatalf("get %q: %v", e.key, err)
+		}
+
+		if !bytes.Equal(value, e.value) {
+			t.Fatalf("get %q: expected %q, got %q", e.key, e.value, value)
+		}
+	}
+
+	for _, key := range []string{"key", "key0500", "key100"} {
+		if _, err := sst.Get([]byte(key)); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("get %q: expected ErrNotFound, got %v", key, err)
+		}
+	}
+
+	var keys []string
+	scanned, errFn := sst.Scan([]byte("key0495"), []byte("key052"))
+	for k := range scanned {
+		keys = append(keys, string(k))
+	}
+
+	if want := []string{"key050", "key051", "key052"}; !slices.Equal(keys, want) {
+		t.Fatalf("expected keys %q, got %q", want, keys)
+	}
+
+	if err := errFn(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("corrupt block", func(t *testing.T) {
+		// Flip a byte of the first entry's value.
+		data := make([]byte, 1)
+		off := int64(blockHeaderSize + 6 + len("key000"))
+		if _, err := sst.file.ReadAt(data, off); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := fs.OpenFile(sst.file.Name(), os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		if _, err := f.WriteAt([]byte{data[0] ^ 0xFF}, off); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := sst.Get([]byte("key000")); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+			t.Fatalf("expected checksum mismatch, got %v", err)
+		}
+
+		if _, err := sst.Get([]byte("key099")); err != nil {
+			t.Fatalf("expected other blocks to be readable, got %v", err)
+		}
+
+		scanned, errFn := sst.Scan(nil, nil)
+		for k := range scanned {
+			t.Fatalf("expected the scan to stop at the corrupt block, got %q", k)
+		}
+
+		if err := errFn(); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+			t.Fatalf("expected checksum mismatch, got %v", err)
+		}
+	})
+}
+
+func TestCompression(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	var entries []entry
+	for i := range 100 {
+		entries = append(entries, entry{
+			key:   []byte(fmt.Sprintf("key%03d", i)),
+			value: bytes.Repeat([]byte{byte(i)}, 100),
+		})
+	}
+
+	sizes := make(map[CompressionType]int64)
+	for _, c := range []CompressionType{CompressionNone, CompressionFlate} {
+		m := NewSSTableManager(fs, SSTableManagerOptions{
+			Dir:         fmt.Sprintf("compression-%d", c),
+			Compression: c,
+		})
+
+		sst, err := m.newFromEntries(entries)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, e := range entries {
+			value, err := sst.Get(e.key)
+			if err != nil {
+				t.Fatalf("compression %d: get %q: %v", c, e.key, err)
+			}
+
+			if !bytes.Equal(value, e.value) {
+				t.Fatalf("compression %d: get %q: expected %q, got %q", c, e.key, e.value, value)
+			}
+		}
+
+		info, err := sst.file.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sizes[c] = info.Size()
+	}
+
+	if sizes[CompressionFlate] >= sizes[CompressionNone] {
+		t.Fatalf("expected compressed table to be smaller: %d >= %d", sizes[CompressionFlate], sizes[CompressionNone])
+	}
+}
+
 func compareEntries(t *testing.T, expected, actual []entry) {
 	if len(expected) != len(actual) {
 		t.Fatalf("len(expected) != len(actual): %d != %d\n", len(expected), len(actual))
@@ -249,5 +952,13 @@ func compareEntries(t *testing.T, expected, actual []entry) {
 		if !bytes.Equal(expected[i].value, actual[i].value) {
 			t.Fatalf("entries[%d]: expected.value != actual.value: %s != %s\n", i, expected[i].value, actual[i].value)
 		}
+
+		if expected[i].deleted != actual[i].deleted {
+			t.Fatalf("entries[%d]: expected.deleted != actual.deleted: %t != %t\n", i, expected[i].deleted, actual[i].deleted)
+		}
+
+		if expected[i].seq != actual[i].seq {
+			t.Fatalf("entries[%d]: expected.seq != actual.seq: %d != %d\n", i, expected[i].seq, actual[i].seq)
+		}
 	}
 }
@@ -0,0 +1,131 @@
+package table
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Keys and rows are encoded as a version byte followed by each value. A
+// value is written as a type tag and its raw bytes:
+//
+//	string, []byte: tag | uvarint length | bytes
+//	int64, float64: tag | 8 bytes, big-endian
+//	bool:           tag | 1 byte
+//	NULL:           tag
+//
+// Since every value carries its type and length, the encoding is prefix-free
+// and composite primary keys can't collide.
+const encodingVersion = 1
+
+const (
+	tagString byte = iota + 1
+	tagInt64
+	tagFloat64
+	tagBool
+	tagBytes
+	tagNull
+)
+
+func encode(a []any) ([]byte, error) {
+	p := []byte{encodingVersion}
+
+	for _, value := range a {
+		switch v := value.(type) {
+		case string:
+			p = append(p, tagString)
+			p = binary.AppendUvarint(p, uint64(len(v)))
+			p = append(p, v...)
+		case int:
+			p = append(p, tagInt64)
+			p = binary.BigEndian.AppendUint64(p, uint64(v))
+		case int64:
+			p = append(p, tagInt64)
+			p = binary.BigEndian.AppendUint64(p, uint64(v))
+		case float64:
+			p = append(p, tagFloat64)
+			p = binary.BigEndian.AppendUint64(p, math.Float64bits(v))
+		case bool:
+			p = append(p, tagBool)
+			if v {
+				p = append(p, 1)
+			} else {
+				p = append(p, 0)
+			}
+		case []byte:
+			p = append(p, tagBytes)
+			p = binary.AppendUvarint(p, uint64(len(v)))
+			p = append(p, v...)
+		case NullValue:
+			p = append(p, tagNull)
+		default:
+			return nil, fmt.Errorf("unsupported type %T", value)
+		}
+	}
+
+	return p, nil
+}
+
+var errShortBuffer = errors.New("short buffer")
+
+func decode(p []byte) ([]any, error) {
+	if len(p) == 0 {
+		return nil, errShortBuffer
+	}
+
+	if p[0] != encodingVersion {
+		return nil, fmt.Errorf("unsupported encoding version %d", p[0])
+	}
+
+	p = p[1:]
+
+	var values []any
+	for len(p) > 0 {
+		tag := p[0]
+		p = p[1:]
+
+		switch tag {
+		case tagString, tagBytes:
+			n, size := binary.Uvarint(p)
+			if size <= 0 || uint64(len(p)-size) < n {
+				return nil, errShortBuffer
+			}
+
+			b := p[size : size+int(n)]
+			p = p[size+int(n):]
+
+			if tag == tagString {
+				values = append(values, string(b))
+			} else {
+				values = append(values, append([]byte{}, b...))
+			}
+		case tagInt64, tagFloat64:
+			if len(p) < 8 {
+				return nil, errShortBuffer
+			}
+
+			u := binary.BigEndian.Uint64(p)
+			p = p[8:]
+
+			if tag == tagInt64 {
+				values = append(values, int64(u))
+			} else {
+				values = append(values, math.Float64frombits(u))
+			}
+		case tagBool:
+			if len(p) < 1 {
+				return nil, errShortBuffer
+			}
+
+			values = append(values, p[0] != 0)
+			p = p[1:]
+		case tagNull:
+			values = append(values, NullValue{})
+		default:
+			return nil, fmt.Errorf("unknown type tag %d", tag)
+		}
+	}
+
+	return values, nil
+}
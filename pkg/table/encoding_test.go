@@ -0,0 +1,85 @@
+package table
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestEncoding(t *testing.T) {
+	values := []any{
+		"", "hello", int64(0), int64(-1), int64(math.MaxInt64), 3.25, math.Inf(-1),
+		true, false, []byte{}, []byte{0, 1, 2}, NullValue{},
+	}
+
+	p, err := encode(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := decode(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, values) {
+		t.Fatalf("expected %v, got %v", values, got)
+	}
+
+	// A string primary key only adds a few bytes of overhead.
+	p, err = encode([]any{"id1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []byte{encodingVersion, tagString, 3, 'i', 'd', '1'}; !bytes.Equal(p, want) {
+		t.Fatalf("expected %v, got %v", want, p)
+	}
+
+	for _, p := range [][]byte{
+		nil,
+		{2},
+		{encodingVersion, tagString, 5, 'a'},
+		{encodingVersion, tagInt64, 0},
+		{encodingVersion, 0xff},
+	} {
+		if _, err := decode(p); err == nil {
+			t.Fatalf("decode %v: expected error", p)
+		}
+	}
+}
+
+func TestEncodingComposite(t *testing.T) {
+	// Composite keys are concatenated, so distinct tuples must never share
+	// an encoding, even if their concatenated contents are equal.
+	keys := [][]any{
+		{"id1"},
+		{"id", "1"},
+		{"i", "d1"},
+		{"id1", ""},
+		{"", "id1"},
+		{[]byte("id1")},
+		{"id", []byte("1")},
+		{int64(1)},
+		{int64(1), int64(2)},
+		{true, int64(1)},
+		{NullValue{}},
+		{NullValue{}, ""},
+		{"", NullValue{}},
+	}
+
+	seen := make(map[string]int)
+	for i, key := range keys {
+		p, err := encode(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if j, ok := seen[string(p)]; ok {
+			t.Fatalf("keys %v and %v share encoding %v", keys[j], key, p)
+		}
+
+		seen[string(p)] = i
+	}
+}
@@ -0,0 +1,121 @@
+package table
+
+import (
+	"errors"
+	"fmt"
+)
+
+// JoinCondition joins the rows of two tables whose LeftCol and RightCol
+// values are equal.
+type JoinCondition struct {
+	LeftCol  string
+	RightCol string
+}
+
+// Join returns the inner equi-join of the table with other. Each result row
+// holds the values of the table's columns followed by those of other's.
+//
+// Each predicate filters the table that has its column, with the table
+// taking precedence over other if both have a column of that name.
+//
+// The join is a hash join: the table with fewer rows is loaded into memory
+// and the other one is scanned once to probe it.
+func (t *Table) Join(other *Table, on JoinCondition, where []Predicate) ([][]any, error) {
+	if t.dropped || other.dropped {
+		return nil, ErrDropped
+	}
+
+	leftIdx, err := t.columnIndex(on.LeftCol)
+	if err != nil {
+		return nil, err
+	}
+
+	rightIdx, err := other.columnIndex(on.RightCol)
+	if err != nil {
+		return nil, err
+	}
+
+	if l, r := t.columns[leftIdx], other.columns[rightIdx]; l.Type != r.Type {
+		return nil, fmt.Errorf("can't join column %s with column %s of a different type", l, r)
+	}
+
+	var leftWhere, rightWhere []Predicate
+	for _, predicate := range where {
+		if _, err := t.columnIndex(predicate.ColumnName); err == nil {
+			leftWhere = append(leftWhere, predicate)
+		} else if _, err := other.columnIndex(predicate.ColumnName); err == nil {
+			rightWhere = append(rightWhere, predicate)
+		} else {
+			return nil, fmt.Errorf("unknown column %q", predicate.ColumnName)
+		}
+	}
+
+	build, probe := joinSide{t, leftIdx, leftWhere}, joinSide{other, rightIdx, rightWhere}
+	swapped := other.rowCount < t.rowCount
+	if swapped {
+		build, probe = probe, build
+	}
+
+	// rows holds the rows of the build side by their encoded join value.
+	rows := make(map[string][][]any)
+	var buildErr error
+	err = build.table.scan(build.where, func(_ []byte, row []any) bool {
+		if _, null := row[build.col].(NullValue); null {
+			// NULL never equals a value, not even NULL.
+			return true
+		}
+
+		key, err := encode([]any{row[build.col]})
+		if err != nil {
+			buildErr = fmt.Errorf("encode: %w", err)
+			return false
+		}
+
+		rows[string(key)] = append(rows[string(key)], row)
+		return true
+	})
+	if err := errors.Join(err, buildErr); err != nil {
+		return nil, fmt.Errorf("build: %w", err)
+	}
+
+	var result [][]any
+	var probeErr error
+	err = probe.table.scan(probe.where, func(_ []byte, row []any) bool {
+		if _, null := row[probe.col].(NullValue); null {
+			return true
+		}
+
+		key, err := encode([]any{row[probe.col]})
+		if err != nil {
+			probeErr = fmt.Errorf("encode: %w", err)
+			return false
+		}
+
+		for _, match := range rows[string(key)] {
+			left, right := match, row
+			if swapped {
+				left, right = row, match
+			}
+
+			joined := make([]any, 0, len(left)+len(right))
+			joined = append(joined, left...)
+			joined = append(joined, right...)
+			result = append(result, joined)
+		}
+
+		return true
+	})
+	if err := errors.Join(err, probeErr); err != nil {
+		return nil, fmt.Errorf("probe: %w", err)
+	}
+
+	return result, nil
+}
+
+// joinSide is one of the tables of a join, with its join column and the
+// predicates filtering it.
+type joinSide struct {
+	table *Table
+	col   int
+	where []Predicate
+}
@@ -0,0 +1,99 @@
+package table_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/DerGut/zomdb/pkg/table"
+)
+
+func TestTableJoin(t *testing.T) {
+	users := newTestTable(t, [][]any{
+		{"id1", "foo", 3},
+		{"id2", "bar", 16},
+		{"id3", "baz", 39},
+	})
+
+	orders, err := table.New(table.Spec{
+		Name: filepath.Join(t.TempDir(), "orders"),
+		Columns: []table.Column{
+			{Name: "order", Type: table.ColumnTypeInt64, PrimaryKey: true},
+			{Name: "user", Type: table.ColumnTypeString},
+		},
+	})
+	if err != nil {
+		t.Fatal("new table", err)
+	}
+
+	for i, row := range [][]any{
+		{1, "id1"},
+		{2, "id1"},
+		{3, "id2"},
+		{4, "id4"},
+	} {
+		if err := orders.Insert(row); err != nil {
+			t.Fatalf("insert row %d: %v\n", i, err)
+		}
+	}
+
+	tests := []struct {
+		where []table.Predicate
+		want  []string
+	}{
+		{nil, []string{"id1/1", "id1/2", "id2/3"}},
+		{[]table.Predicate{{ColumnName: "name", Value: "foo"}}, []string{"id1/1", "id1/2"}},
+		{[]table.Predicate{{ColumnName: "order", Value: int64(2), Op: table.OpGTE}}, []string{"id1/2", "id2/3"}},
+		{[]table.Predicate{{ColumnName: "name", Value: "baz"}}, nil},
+	}
+
+	for _, tt := range tests {
+		// The users table has fewer rows, so it's loaded into memory.
+		rows, err := users.Join(orders, table.JoinCondition{LeftCol: "id", RightCol: "user"}, tt.where)
+		if err != nil {
+			t.Fatalf("join %v: %v", tt.where, err)
+		}
+
+		var got []string
+		for _, row := range rows {
+			if len(row) != 5 || row[0] != row[4] {
+				t.Fatalf("join %v: unexpected row %v", tt.where, row)
+			}
+
+			got = append(got, fmt.Sprintf("%s/%d", row[0], row[3]))
+		}
+
+		slices.Sort(got)
+
+		if !slices.Equal(got, tt.want) {
+			t.Fatalf("join %v: Expected %v, got %v", tt.where, tt.want, got)
+		}
+
+		// Joining the other way around loads the orders table instead,
+		// the columns of the result are swapped accordingly.
+		rows, err = orders.Join(users, table.JoinCondition{LeftCol: "user", RightCol: "id"}, tt.where)
+		if err != nil {
+			t.Fatalf("reverse join %v: %v", tt.where, err)
+		}
+
+		got = nil
+		for _, row := range rows {
+			got = append(got, fmt.Sprintf("%s/%d", row[2], row[0]))
+		}
+
+		slices.Sort(got)
+
+		if !slices.Equal(got, tt.want) {
+			t.Fatalf("reverse join %v: Expected %v, got %v", tt.where, tt.want, got)
+		}
+	}
+
+	if _, err := users.Join(orders, table.JoinCondition{LeftCol: "amount", RightCol: "user"}, nil); err == nil {
+		t.Fatal("join columns of different types: expected error")
+	}
+
+	if _, err := users.Join(orders, table.JoinCondition{LeftCol: "id", RightCol: "user"}, []table.Predicate{{ColumnName: "unknown"}}); err == nil {
+		t.Fatal("join with unknown predicate column: expected error")
+	}
+}
@@ -0,0 +1,97 @@
+package table
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// ErrSchemaMismatch is returned by New if the columns of the spec differ
+// from the ones the table was created with.
+var ErrSchemaMismatch = errors.New("schema mismatch")
+
+// schemaPath returns the path of the file that holds the columns of the
+// table. It lives next to the heap file.
+func schemaPath(name string) string {
+	return name + ".schema"
+}
+
+// loadSchema validates the columns against the stored schema of the table.
+// If there is none yet, the columns are stored instead.
+func loadSchema(name string, columns []Column) error {
+	p, err := os.ReadFile(schemaPath(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return storeSchema(name, columns)
+	} else if err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+
+	stored, err := decodeSchema(p)
+	if err != nil {
+		return fmt.Errorf("decode: %w", err)
+	}
+
+	if !slices.Equal(stored, columns) {
+		return fmt.Errorf("%w: stored columns %v, got %v", ErrSchemaMismatch, stored, columns)
+	}
+
+	return nil
+}
+
+// storeSchema writes the columns to a temporary file first, so that a crash
+// never leaves a partial schema behind.
+func storeSchema(name string, columns []Column) error {
+	p, err := encodeSchema(columns)
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+
+	tmp := schemaPath(name) + ".tmp"
+	if err := os.WriteFile(tmp, p, 0o644); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+
+	if err := os.Rename(tmp, schemaPath(name)); err != nil {
+		return fmt.Errorf("rename: %w", err)
+	}
+
+	return nil
+}
+
+// The schema is encoded like a row, with the name, type, primary key and
+// nullable flag of each column.
+func encodeSchema(columns []Column) ([]byte, error) {
+	values := make([]any, 0, 4*len(columns))
+	for _, col := range columns {
+		values = append(values, col.Name, int64(col.Type), col.PrimaryKey, col.Nullable)
+	}
+
+	return encode(values)
+}
+
+func decodeSchema(p []byte) ([]Column, error) {
+	values, err := decode(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(values)%4 != 0 {
+		return nil, fmt.Errorf("invalid number of values %d", len(values))
+	}
+
+	columns := make([]Column, 0, len(values)/4)
+	for i := 0; i < len(values); i += 4 {
+		name, ok1 := values[i].(string)
+		typ, ok2 := values[i+1].(int64)
+		pk, ok3 := values[i+2].(bool)
+		nullable, ok4 := values[i+3].(bool)
+		if !ok1 || !ok2 || !ok3 || !ok4 {
+			return nil, fmt.Errorf("invalid column %d", i/4)
+		}
+
+		columns = append(columns, Column{Name: name, Type: ColumnType(typ), PrimaryKey: pk, Nullable: nullable})
+	}
+
+	return columns, nil
+}
@@ -1,24 +1,71 @@
 package table
 
 import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
 
 	"github.com/DerGut/zomdb/pkg/heap"
-	"github.com/fxamacker/cbor/v2"
+	"github.com/DerGut/zomdb/pkg/index"
 )
 
+var ErrNotFound = errors.New("not found")
+
+// ErrNotNullViolation is returned when writing NULL to a column that isn't
+// nullable.
+var ErrNotNullViolation = errors.New("not null violation")
+
+// ErrDropped is returned by all methods of a table after it was dropped.
+var ErrDropped = errors.New("table dropped")
+
 type Table struct {
+	name string
 	heap *heap.Heap
 
+	// dropped is set by Drop, the table must not be used afterwards.
+	dropped bool
+
 	columns []Column
 	pkIdxs  []int
+
+	// rowCount is the number of rows in the table. It's tracked in memory
+	// while the table is open, Close persists it in the heap under
+	// rowCountKey.
+	rowCount int64
+	// rowCountStored reports whether the heap holds the current row count.
+	rowCountStored bool
+
+	// indexes holds the secondary indexes by column name. They map the
+	// encoded column value to the id of a row with that value.
+	indexes map[string]index.Index
+	// The heap doesn't expose offsets, so rows referenced by an index are
+	// identified by an id that maps to their heap key instead.
+	rowIDs  map[string]int64
+	rowKeys [][]byte
+}
+
+// Metadata is stored in the heap next to the rows. Metadata keys start with
+// a null byte, while encoded primary keys start with their format version.
+var rowCountKey = []byte("\x00rowcount")
+
+func isMetadataKey(key []byte) bool {
+	return len(key) > 0 && key[0] == 0
 }
 
 func New(spec Spec) (*Table, error) {
 	var primaryKeys []int
 	for i, col := range spec.Columns {
 		if col.PrimaryKey {
+			if col.Nullable {
+				return nil, fmt.Errorf("column %s: primary key can't be nullable", col)
+			}
+
 			primaryKeys = append(primaryKeys, i)
 		}
 	}
@@ -27,16 +74,151 @@ func New(spec Spec) (*Table, error) {
 		return nil, errors.New("no primary key defined")
 	}
 
+	if err := loadSchema(spec.Name, spec.Columns); err != nil {
+		return nil, fmt.Errorf("load schema: %w", err)
+	}
+
 	h, err := heap.New(spec.Name)
 	if err != nil {
 		return nil, fmt.Errorf("new heap: %w", err)
 	}
 
-	return &Table{
+	t := Table{
+		name:    spec.Name,
 		heap:    h,
 		columns: spec.Columns,
 		pkIdxs:  primaryKeys,
-	}, nil
+	}
+
+	if err := t.loadRowCount(); err != nil {
+		h.Close()
+		return nil, fmt.Errorf("load row count: %w", err)
+	}
+
+	return &t, nil
+}
+
+// loadRowCount reads the row count that Close stored in the heap. Tables
+// that don't have it stored are counted once.
+func (t *Table) loadRowCount() error {
+	b, err := t.heap.Get(rowCountKey)
+	if errors.Is(err, heap.ErrNotFound) {
+		var n int64
+		err := t.scan(nil, func([]byte, []any) bool {
+			n++
+			return true
+		})
+		if err != nil {
+			return err
+		}
+
+		t.rowCount = n
+
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if len(b) != 8 {
+		return fmt.Errorf("invalid row count of size %d", len(b))
+	}
+
+	t.rowCount = int64(binary.BigEndian.Uint64(b))
+	t.rowCountStored = true
+
+	return nil
+}
+
+// invalidateRowCount removes the stored row count before the first write
+// that changes it. A table that isn't closed afterwards, e.g. because the
+// process crashed, is thus counted again rather than trusting a stale
+// count.
+func (t *Table) invalidateRowCount() error {
+	if !t.rowCountStored {
+		return nil
+	}
+
+	if err := t.heap.Delete(rowCountKey); err != nil {
+		return fmt.Errorf("delete row count: %w", err)
+	}
+
+	if err := t.heap.Sync(); err != nil {
+		return fmt.Errorf("sync: %w", err)
+	}
+
+	t.rowCountStored = false
+
+	return nil
+}
+
+// Close stores the row count if it changed, closes the indexes that
+// implement io.Closer and closes the heap. The table must not be used
+// afterwards.
+func (t *Table) Close() error {
+	if t.dropped {
+		return ErrDropped
+	}
+
+	var errs []error
+	if !t.rowCountStored {
+		if err := t.heap.Set(rowCountKey, binary.BigEndian.AppendUint64(nil, uint64(t.rowCount))); err != nil {
+			errs = append(errs, fmt.Errorf("store row count: %w", err))
+		} else if err := t.heap.Sync(); err != nil {
+			errs = append(errs, fmt.Errorf("sync: %w", err))
+		}
+	}
+
+	for name, idx := range t.indexes {
+		if c, ok := idx.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("close index %s: %w", name, err))
+			}
+		}
+	}
+
+	if err := t.heap.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("close heap: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Drop closes the table and deletes its heap and schema files. Indexes that implement
+// io.Closer are closed, their storage is owned by the caller. The table
+// must not be used afterwards, all methods return ErrDropped.
+func (t *Table) Drop() error {
+	if t.dropped {
+		return ErrDropped
+	}
+
+	t.dropped = true
+
+	var errs []error
+	for name, idx := range t.indexes {
+		if c, ok := idx.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("close index %s: %w", name, err))
+			}
+		}
+	}
+
+	t.indexes = nil
+	t.rowIDs = nil
+	t.rowKeys = nil
+
+	if err := t.heap.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("close heap: %w", err))
+	}
+
+	if err := os.Remove(t.name); err != nil {
+		errs = append(errs, fmt.Errorf("remove heap file: %w", err))
+	}
+
+	if err := os.Remove(schemaPath(t.name)); err != nil {
+		errs = append(errs, fmt.Errorf("remove schema file: %w", err))
+	}
+
+	return errors.Join(errs...)
 }
 
 type Spec struct {
@@ -48,6 +230,8 @@ type Column struct {
 	Name       string
 	Type       ColumnType
 	PrimaryKey bool
+	// Nullable allows NullValue as the column's value.
+	Nullable bool
 }
 
 func (c Column) String() string {
@@ -59,16 +243,46 @@ type ColumnType int
 const (
 	ColumnTypeString ColumnType = iota
 	ColumnTypeInt64
+	ColumnTypeFloat64
+	ColumnTypeBool
+	ColumnTypeBytes
 )
 
+// NullValue is the value of a nullable column that holds no value. It's
+// accepted by columns of any type.
+//
+// NULL never equals a value. Predicates only match it if their value is
+// NULL as well.
+type NullValue struct{}
+
 func (t *Table) Insert(values []any) error {
+	if t.dropped {
+		return ErrDropped
+	}
+
+	return t.put(values)
+}
+
+// Upsert inserts the row, or replaces the row with the same primary key if
+// it already exists.
+func (t *Table) Upsert(values []any) error {
+	if t.dropped {
+		return ErrDropped
+	}
+
+	return t.put(values)
+}
+
+// put validates the row and writes it to the heap, overwriting any row with
+// the same primary key.
+func (t *Table) put(values []any) error {
 	if len(values) != len(t.columns) {
-		// We don't yet support nullable values.
+		// Missing values must be passed as NullValue explicitly.
 		return fmt.Errorf("must pass no. of values equal to no. of columns, passed: %d", len(values))
 	}
 
 	for i := range values {
-		if err := validateColumnType(values[i], t.columns[i].Type); err != nil {
+		if err := validateColumnType(values[i], t.columns[i]); err != nil {
 			return fmt.Errorf("column %s: %w", t.columns[i], err)
 		}
 	}
@@ -83,23 +297,93 @@ func (t *Table) Insert(values []any) error {
 		return fmt.Errorf("build value: %w", err)
 	}
 
-	return t.heap.Set(key, value)
+	_, err = t.heap.Get(key)
+	exists := err == nil
+	if err != nil && !errors.Is(err, heap.ErrNotFound) {
+		return fmt.Errorf("heap get: %w", err)
+	}
+
+	if !exists {
+		if err := t.invalidateRowCount(); err != nil {
+			return err
+		}
+	}
+
+	if err := t.heap.Set(key, value); err != nil {
+		return err
+	}
+
+	if err := t.updateIndexes(key, values); err != nil {
+		return err
+	}
+
+	if !exists {
+		t.rowCount++
+	}
+
+	return nil
+}
+
+// Count returns the number of rows matching the predicates. Without
+// predicates, it returns the tracked row count instead of scanning the table.
+func (t *Table) Count(where []Predicate) (int64, error) {
+	if t.dropped {
+		return 0, ErrDropped
+	}
+
+	if len(where) == 0 {
+		return t.rowCount, nil
+	}
+
+	var n int64
+	err := t.scan(where, func([]byte, []any) bool {
+		n++
+		return true
+	})
+	if err != nil {
+		return 0, fmt.Errorf("sequential scan: %w", err)
+	}
+
+	return n, nil
 }
 
 // Select retrieves a single row from the table.
 //
 // TODO: Don't assume predicates are ANDed.
 func (t *Table) Select(where []Predicate) ([]any, error) {
+	if t.dropped {
+		return nil, ErrDropped
+	}
+
 	if pks, ok := t.primaryKeysFromPredicates(where); ok {
 		row, err := t.indexScan(pks)
 		if err != nil {
 			return nil, fmt.Errorf("index scan: %w", err)
 		}
 
+		// The other predicates may still rule the row out.
+		match, err := t.matches(row, where)
+		if err != nil {
+			return nil, err
+		}
+
+		if !match {
+			return nil, ErrNotFound
+		}
+
+		return row, nil
+	}
+
+	row, ok, err := t.secondaryIndexScan(where)
+	if err != nil {
+		return nil, fmt.Errorf("secondary index scan: %w", err)
+	}
+
+	if ok {
 		return row, nil
 	}
 
-	row, err := t.sequentialScan(where)
+	row, err = t.sequentialScan(where)
 	if err != nil {
 		return nil, fmt.Errorf("sequential scan: %w", err)
 	}
@@ -107,11 +391,586 @@ func (t *Table) Select(where []Predicate) ([]any, error) {
 	return row, nil
 }
 
+// ExplainSelect describes how Select would look up a row matching the
+// predicates, without running the query.
+func (t *Table) ExplainSelect(where []Predicate) string {
+	if t.dropped {
+		return ErrDropped.Error()
+	}
+
+	if _, ok := t.primaryKeysFromPredicates(where); ok {
+		names := make([]string, len(t.pkIdxs))
+		for i, idx := range t.pkIdxs {
+			names[i] = t.columns[idx].Name
+		}
+
+		return "index scan on " + strings.Join(names, ", ")
+	}
+
+	var unindexed []string
+	for _, predicate := range where {
+		if _, ok := t.indexes[predicate.ColumnName]; ok && predicate.Op == OpEQ {
+			return "secondary index scan on " + predicate.ColumnName
+		}
+
+		if !slices.Contains(unindexed, predicate.ColumnName) {
+			unindexed = append(unindexed, predicate.ColumnName)
+		}
+	}
+
+	if len(unindexed) == 0 {
+		return "sequential scan"
+	}
+
+	return fmt.Sprintf("sequential scan (no index for column: %s)", strings.Join(unindexed, ", "))
+}
+
+// SelectMultiple retrieves all rows matching the predicates.
+func (t *Table) SelectMultiple(where []Predicate) ([][]any, error) {
+	return t.SelectMultipleWithOptions(where, SelectOptions{})
+}
+
+type SelectOptions struct {
+	// OrderBy is the name of the column to sort the result by. The result
+	// isn't sorted if it's empty.
+	OrderBy string
+	// Desc sorts the result in descending order.
+	Desc bool
+
+	// Offset skips the given number of matching rows.
+	Offset int
+	// Limit is the maximum number of rows to return. All rows are returned
+	// if it's zero.
+	Limit int
+}
+
+// SelectMultipleWithOptions retrieves all rows matching the predicates,
+// shaped by the given options.
+func (t *Table) SelectMultipleWithOptions(where []Predicate, opts SelectOptions) ([][]any, error) {
+	if t.dropped {
+		return nil, ErrDropped
+	}
+
+	if opts.Offset < 0 || opts.Limit < 0 {
+		return nil, fmt.Errorf("negative offset or limit: %d, %d", opts.Offset, opts.Limit)
+	}
+
+	orderIdx := -1
+	if opts.OrderBy != "" {
+		idx, err := t.columnIndex(opts.OrderBy)
+		if err != nil {
+			return nil, err
+		}
+
+		orderIdx = idx
+	}
+
+	// Without sorting, the scan can stop as soon as it has found enough rows.
+	var limit int
+	if orderIdx < 0 && opts.Limit > 0 {
+		limit = opts.Offset + opts.Limit
+	}
+
+	rows, err := t.findRows(where, limit)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	result := make([][]any, len(rows))
+	for i, row := range rows {
+		result[i] = row.values
+	}
+
+	if orderIdx >= 0 {
+		var sortErr error
+		slices.SortStableFunc(result, func(a, b []any) int {
+			c, err := compareValues(a[orderIdx], b[orderIdx])
+			if err != nil {
+				sortErr = err
+			}
+
+			if opts.Desc {
+				return -c
+			}
+
+			return c
+		})
+
+		if sortErr != nil {
+			return nil, fmt.Errorf("column %s: %w", t.columns[orderIdx], sortErr)
+		}
+	}
+
+	result = result[min(opts.Offset, len(result)):]
+	if opts.Limit > 0 && len(result) > opts.Limit {
+		result = result[:opts.Limit]
+	}
+
+	return result, nil
+}
+
+type AggregateFunc int
+
+const (
+	AggregateSum AggregateFunc = iota
+	AggregateMin
+	AggregateMax
+	AggregateAvg
+)
+
+// Aggregate computes fn over the column values of all rows matching the
+// predicates. Sum and Avg require a numeric column, Min and Max any ordered
+// column. NULL values are ignored. It returns ErrNotFound if no rows with
+// values match.
+//
+// Sum returns the column's type, Avg always returns a float64.
+func (t *Table) Aggregate(fn AggregateFunc, col string, where []Predicate) (any, error) {
+	if t.dropped {
+		return nil, ErrDropped
+	}
+
+	idx, err := t.columnIndex(col)
+	if err != nil {
+		return nil, err
+	}
+
+	colType := t.columns[idx].Type
+	numeric := colType == ColumnTypeInt64 || colType == ColumnTypeFloat64
+
+	switch fn {
+	case AggregateSum, AggregateAvg:
+		if !numeric {
+			return nil, fmt.Errorf("column %s: not numeric", t.columns[idx])
+		}
+	case AggregateMin, AggregateMax:
+		if colType == ColumnTypeBool {
+			return nil, fmt.Errorf("column %s: not ordered", t.columns[idx])
+		}
+	default:
+		return nil, fmt.Errorf("unknown aggregate function %d", fn)
+	}
+
+	rows, err := t.SelectMultiple(where)
+	if err != nil {
+		return nil, err
+	}
+
+	// NULLs are ignored.
+	rows = slices.DeleteFunc(rows, func(row []any) bool {
+		_, null := row[idx].(NullValue)
+		return null
+	})
+
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+
+	switch fn {
+	case AggregateSum, AggregateAvg:
+		var sumInt int64
+		var sumFloat float64
+		for _, row := range rows {
+			switch v := row[idx].(type) {
+			case int64:
+				sumInt += v
+			case float64:
+				sumFloat += v
+			}
+		}
+
+		if fn == AggregateAvg {
+			return (float64(sumInt) + sumFloat) / float64(len(rows)), nil
+		}
+
+		if colType == ColumnTypeInt64 {
+			return sumInt, nil
+		}
+
+		return sumFloat, nil
+	default:
+		result := rows[0][idx]
+		for _, row := range rows[1:] {
+			c, err := compareValues(row[idx], result)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", t.columns[idx], err)
+			}
+
+			if (fn == AggregateMin && c < 0) || (fn == AggregateMax && c > 0) {
+				result = row[idx]
+			}
+		}
+
+		return result, nil
+	}
+}
+
+// Delete removes all rows matching the predicates and returns the number of
+// deleted rows. Secondary indexes are updated accordingly.
+//
+// If the predicates cover the primary key and no row matches, it returns
+// ErrNotFound.
+func (t *Table) Delete(where []Predicate) (int, error) {
+	if t.dropped {
+		return 0, ErrDropped
+	}
+
+	rows, err := t.findRows(where, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(rows) > 0 {
+		if err := t.invalidateRowCount(); err != nil {
+			return 0, err
+		}
+	}
+
+	for i, row := range rows {
+		if err := t.heap.Delete(row.key); err != nil {
+			t.rowCount -= int64(i)
+			return i, fmt.Errorf("heap delete: %w", err)
+		}
+	}
+
+	t.rowCount -= int64(len(rows))
+
+	if err := t.deleteIndexes(rows); err != nil {
+		return len(rows), fmt.Errorf("update indexes: %w", err)
+	}
+
+	return len(rows), nil
+}
+
+// Assignment sets the column to the given value.
+type Assignment struct {
+	ColumnName string
+	Value      any
+}
+
+// Update applies the assignments to all rows matching the predicates and
+// returns the number of updated rows. Primary key columns can't be updated.
+//
+// If the predicates cover the primary key and no row matches, it returns
+// ErrNotFound.
+func (t *Table) Update(set []Assignment, where []Predicate) (int, error) {
+	if t.dropped {
+		return 0, ErrDropped
+	}
+
+	idxs := make([]int, len(set))
+	for i, assignment := range set {
+		idx, err := t.columnIndex(assignment.ColumnName)
+		if err != nil {
+			return 0, err
+		}
+
+		if t.columns[idx].PrimaryKey {
+			return 0, fmt.Errorf("column %s: can't update primary key", t.columns[idx])
+		}
+
+		if err := validateColumnType(assignment.Value, t.columns[idx]); err != nil {
+			return 0, fmt.Errorf("column %s: %w", t.columns[idx], err)
+		}
+
+		idxs[i] = idx
+	}
+
+	rows, err := t.findRows(where, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, row := range rows {
+		for j, assignment := range set {
+			row.values[idxs[j]] = assignment.Value
+		}
+
+		value, err := encode(row.values)
+		if err != nil {
+			return i, fmt.Errorf("build value: %w", err)
+		}
+
+		if err := t.heap.Set(row.key, value); err != nil {
+			return i, fmt.Errorf("heap set: %w", err)
+		}
+
+		if err := t.updateIndexes(row.key, row.values); err != nil {
+			return i, err
+		}
+	}
+
+	return len(rows), nil
+}
+
+// CreateIndex registers a secondary index on the column. It's populated with
+// all existing rows and kept up to date on writes. Select uses it for
+// equality predicates on the column.
+//
+// Each column value is mapped to a single row, so the index is most useful
+// for columns with unique values.
+func (t *Table) CreateIndex(columnName string, idx index.Index) error {
+	if t.dropped {
+		return ErrDropped
+	}
+
+	colIdx, err := t.columnIndex(columnName)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := t.indexes[columnName]; ok {
+		return fmt.Errorf("column %s: already indexed", t.columns[colIdx])
+	}
+
+	var putErr error
+	err = t.scan(nil, func(key []byte, values []any) bool {
+		putErr = t.putIndex(idx, key, values[colIdx])
+		return putErr == nil
+	})
+	if err := errors.Join(err, putErr); err != nil {
+		return fmt.Errorf("populate index: %w", err)
+	}
+
+	if t.indexes == nil {
+		t.indexes = make(map[string]index.Index)
+	}
+
+	t.indexes[columnName] = idx
+
+	return nil
+}
+
+func (t *Table) updateIndexes(key []byte, values []any) error {
+	for name, idx := range t.indexes {
+		colIdx, err := t.columnIndex(name)
+		if err != nil {
+			return err
+		}
+
+		if err := t.putIndex(idx, key, values[colIdx]); err != nil {
+			return fmt.Errorf("index %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// deleteIndexes removes the index entries of the deleted rows. Since an
+// index maps each value to a single row, entries are only affected if they
+// point to one of the rows. If another row has the same value, the entry is
+// pointed to that row instead.
+func (t *Table) deleteIndexes(rows []row) error {
+	// stale holds the affected encoded values by index name.
+	stale := make(map[string]map[string]bool)
+	for name, idx := range t.indexes {
+		colIdx, err := t.columnIndex(name)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			indexKey, err := encode([]any{row.values[colIdx]})
+			if err != nil {
+				return fmt.Errorf("encode: %w", err)
+			}
+
+			id, err := idx.GetOffset(indexKey)
+			if errors.Is(err, index.ErrNotFound) {
+				continue
+			} else if err != nil {
+				return fmt.Errorf("index %s: %w", name, err)
+			}
+
+			if rowID, ok := t.rowIDs[string(row.key)]; !ok || rowID != id {
+				continue
+			}
+
+			if stale[name] == nil {
+				stale[name] = make(map[string]bool)
+			}
+
+			stale[name][string(indexKey)] = true
+		}
+	}
+
+	if len(stale) == 0 {
+		return nil
+	}
+
+	var putErr error
+	err := t.scan(nil, func(key []byte, values []any) bool {
+		for name, indexKeys := range stale {
+			colIdx, err := t.columnIndex(name)
+			if err != nil {
+				putErr = err
+				return false
+			}
+
+			indexKey, err := encode([]any{values[colIdx]})
+			if err != nil {
+				putErr = fmt.Errorf("encode: %w", err)
+				return false
+			}
+
+			if !indexKeys[string(indexKey)] {
+				continue
+			}
+
+			if err := t.putIndex(t.indexes[name], key, values[colIdx]); err != nil {
+				putErr = fmt.Errorf("index %s: %w", name, err)
+				return false
+			}
+
+			delete(indexKeys, string(indexKey))
+		}
+
+		return true
+	})
+	if err := errors.Join(err, putErr); err != nil {
+		return fmt.Errorf("reindex: %w", err)
+	}
+
+	for name, indexKeys := range stale {
+		for indexKey := range indexKeys {
+			if err := t.indexes[name].Delete([]byte(indexKey)); err != nil {
+				return fmt.Errorf("index %s: %w", name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (t *Table) putIndex(idx index.Index, key []byte, value any) error {
+	indexKey, err := encode([]any{value})
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+
+	return idx.PutOffset(indexKey, t.rowID(key))
+}
+
+// rowID returns the id of the row with the heap key, assigning a new one if
+// needed.
+func (t *Table) rowID(key []byte) int64 {
+	if id, ok := t.rowIDs[string(key)]; ok {
+		return id
+	}
+
+	if t.rowIDs == nil {
+		t.rowIDs = make(map[string]int64)
+	}
+
+	id := int64(len(t.rowKeys))
+	t.rowIDs[string(key)] = id
+	t.rowKeys = append(t.rowKeys, key)
+
+	return id
+}
+
+// secondaryIndexScan looks up a row matching the predicates through a
+// secondary index. It returns false if no index applies or if the indexed
+// row doesn't match anymore, e.g. because it was deleted.
+func (t *Table) secondaryIndexScan(where []Predicate) ([]any, bool, error) {
+	for _, predicate := range where {
+		idx, ok := t.indexes[predicate.ColumnName]
+		if !ok || predicate.Op != OpEQ {
+			continue
+		}
+
+		indexKey, err := encode([]any{predicate.Value})
+		if err != nil {
+			return nil, false, fmt.Errorf("encode: %w", err)
+		}
+
+		id, err := idx.GetOffset(indexKey)
+		if errors.Is(err, index.ErrNotFound) {
+			// All live values are indexed, so no row has this value.
+			return nil, true, ErrNotFound
+		} else if err != nil {
+			return nil, false, fmt.Errorf("index %s: %w", predicate.ColumnName, err)
+		}
+
+		if id < 0 || id >= int64(len(t.rowKeys)) {
+			return nil, false, nil
+		}
+
+		b, err := t.heap.Get(t.rowKeys[id])
+		if errors.Is(err, heap.ErrNotFound) {
+			return nil, false, nil
+		} else if err != nil {
+			return nil, false, fmt.Errorf("get: %w", err)
+		}
+
+		row, err := decode(b)
+		if err != nil {
+			return nil, false, err
+		}
+
+		match, err := t.matches(row, where)
+		if err != nil || !match {
+			return nil, false, err
+		}
+
+		return row, true, nil
+	}
+
+	return nil, false, nil
+}
+
+type row struct {
+	key    []byte
+	values []any
+}
+
+// findRows returns all rows matching the predicates, or at most limit rows
+// if limit is positive. If the predicates cover the primary key, the row is
+// looked up directly and ErrNotFound is returned if it doesn't match.
+func (t *Table) findRows(where []Predicate, limit int) ([]row, error) {
+	if pks, ok := t.primaryKeysFromPredicates(where); ok {
+		values, err := t.indexScan(pks)
+		if err != nil {
+			return nil, fmt.Errorf("index scan: %w", err)
+		}
+
+		match, err := t.matches(values, where)
+		if err != nil {
+			return nil, err
+		}
+
+		if !match {
+			return nil, ErrNotFound
+		}
+
+		key, err := t.buildKey(values)
+		if err != nil {
+			return nil, fmt.Errorf("build key: %w", err)
+		}
+
+		return []row{{key: key, values: values}}, nil
+	}
+
+	// Rows are collected first, since callers shouldn't modify the heap
+	// while iterating over it.
+	var rows []row
+	err := t.scan(where, func(key []byte, values []any) bool {
+		rows = append(rows, row{key: key, values: values})
+		return limit <= 0 || len(rows) < limit
+	})
+	if err != nil {
+		return nil, fmt.Errorf("sequential scan: %w", err)
+	}
+
+	return rows, nil
+}
+
 func (t *Table) primaryKeysFromPredicates(predicates []Predicate) ([]any, bool) {
 	pks := make([]any, 0, len(t.pkIdxs))
 	for _, idx := range t.pkIdxs {
 		for _, predicate := range predicates {
-			if t.columns[idx].Name == predicate.ColumnName {
+			if predicate.Op == OpEQ && t.columns[idx].Name == predicate.ColumnName {
 				pks = append(pks, predicate.Value)
 			}
 		}
@@ -132,7 +991,9 @@ func (t *Table) indexScan(pks []any) ([]any, error) {
 	}
 
 	b, err := t.heap.Get(key)
-	if err != nil {
+	if errors.Is(err, heap.ErrNotFound) {
+		return nil, ErrNotFound
+	} else if err != nil {
 		return nil, fmt.Errorf("get: %w", err)
 	}
 
@@ -144,22 +1005,188 @@ func (t *Table) indexScan(pks []any) ([]any, error) {
 	return row, nil
 }
 
+// sequentialScan returns the first row matching the predicates, or
+// ErrNotFound if there is none.
 func (t *Table) sequentialScan(where []Predicate) ([]any, error) {
+	var found []any
+	err := t.scan(where, func(_ []byte, row []any) bool {
+		found = row
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if found == nil {
+		return nil, ErrNotFound
+	}
+
+	return found, nil
+}
+
+// scan calls fn with the heap key and the values of each row that matches
+// the predicates, until fn returns false.
+func (t *Table) scan(where []Predicate, fn func(key []byte, row []any) bool) error {
 	for key, value := range t.heap.All() {
-		_, _ = key, value
+		if isMetadataKey(key) {
+			continue
+		}
+
+		row, err := decode(value)
+		if err != nil {
+			return fmt.Errorf("decode: %w", err)
+		}
+
+		match, err := t.matches(row, where)
+		if err != nil {
+			return err
+		}
+
+		if match && !fn(key, row) {
+			return nil
+		}
 	}
-	return nil, errors.New("not implemented")
+
+	if err := t.heap.Err(); err != nil {
+		return fmt.Errorf("heap: %w", err)
+	}
+
+	return nil
 }
 
-// Predicate matches which row's column value equals the given value.
-//
-// TODO: Support more operators to be able to return multiple results from
-// select.
+// matches reports whether the row satisfies all predicates.
+func (t *Table) matches(row []any, where []Predicate) (bool, error) {
+	for _, predicate := range where {
+		idx, err := t.columnIndex(predicate.ColumnName)
+		if err != nil {
+			return false, err
+		}
+
+		_, rowNull := row[idx].(NullValue)
+		_, predicateNull := predicate.Value.(NullValue)
+		if rowNull != predicateNull {
+			return false, nil
+		}
+
+		c, err := compareValues(row[idx], predicate.Value)
+		if err != nil {
+			return false, fmt.Errorf("column %s: %w", t.columns[idx], err)
+		}
+
+		if !predicate.Op.holds(c) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// compareValues returns -1, 0 or +1 depending on whether a is less than,
+// equal to or greater than b. Both values must be of the same column type.
+func compareValues(a, b any) (int, error) {
+	// Decoded values are int64, while callers may pass int.
+	if i, ok := a.(int); ok {
+		a = int64(i)
+	}
+
+	if i, ok := b.(int); ok {
+		b = int64(i)
+	}
+
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), nil
+		}
+	case int64:
+		if b, ok := b.(int64); ok {
+			return cmp.Compare(a, b), nil
+		}
+	case float64:
+		if b, ok := b.(float64); ok {
+			return cmp.Compare(a, b), nil
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			switch {
+			case a == b:
+				return 0, nil
+			case !a:
+				return -1, nil
+			default:
+				return 1, nil
+			}
+		}
+	case []byte:
+		if b, ok := b.([]byte); ok {
+			return bytes.Compare(a, b), nil
+		}
+	case NullValue:
+		// NULL sorts before all other values.
+		if _, ok := b.(NullValue); ok {
+			return 0, nil
+		}
+
+		return -1, nil
+	}
+
+	if _, ok := b.(NullValue); ok {
+		return 1, nil
+	}
+
+	return 0, fmt.Errorf("can't compare %T with %T", a, b)
+}
+
+func (t *Table) columnIndex(name string) (int, error) {
+	for i, col := range t.columns {
+		if col.Name == name {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown column %q", name)
+}
+
+// Predicate matches rows whose column value compares to the given value as
+// described by the operator. The zero value of Op tests for equality.
 type Predicate struct {
 	ColumnName string
+	Op         PredicateOp
 	Value      any
 }
 
+type PredicateOp int
+
+const (
+	OpEQ PredicateOp = iota
+	OpNE
+	OpLT
+	OpLTE
+	OpGT
+	OpGTE
+)
+
+// holds reports whether the operator is satisfied given the result of
+// comparing the column value with the predicate's value.
+func (op PredicateOp) holds(c int) bool {
+	switch op {
+	case OpEQ:
+		return c == 0
+	case OpNE:
+		return c != 0
+	case OpLT:
+		return c < 0
+	case OpLTE:
+		return c <= 0
+	case OpGT:
+		return c > 0
+	case OpGTE:
+		return c >= 0
+	default:
+		return false
+	}
+}
+
 func (t *Table) buildKey(values []any) ([]byte, error) {
 	key := make([]any, len(t.pkIdxs))
 	for i, idx := range t.pkIdxs {
@@ -169,21 +1196,16 @@ func (t *Table) buildKey(values []any) ([]byte, error) {
 	return encode(key)
 }
 
-func encode(a []any) ([]byte, error) {
-	return cbor.Marshal(a)
-}
+func validateColumnType(value any, col Column) error {
+	if _, ok := value.(NullValue); ok {
+		if !col.Nullable {
+			return ErrNotNullViolation
+		}
 
-func decode(p []byte) ([]any, error) {
-	var values []any
-	if err := cbor.Unmarshal(p, &values); err != nil {
-		return nil, err
+		return nil
 	}
 
-	return values, nil
-}
-
-func validateColumnType(value any, colType ColumnType) error {
-	switch colType {
+	switch col.Type {
 	case ColumnTypeString:
 		if _, ok := value.(string); !ok {
 			return fmt.Errorf("expected string value, received %T", value)
@@ -195,6 +1217,18 @@ func validateColumnType(value any, colType ColumnType) error {
 		default:
 			return fmt.Errorf("expected int64 value, received %T", value)
 		}
+	case ColumnTypeFloat64:
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("expected float64 value, received %T", value)
+		}
+	case ColumnTypeBool:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("expected bool value, received %T", value)
+		}
+	case ColumnTypeBytes:
+		if _, ok := value.([]byte); !ok {
+			return fmt.Errorf("expected []byte value, received %T", value)
+		}
 
 	default:
 		return fmt.Errorf("unsupported type %T", value)
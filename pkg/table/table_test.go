@@ -1,9 +1,14 @@
 package table_test
 
 import (
+	"bytes"
+	"errors"
+	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 
+	"github.com/DerGut/zomdb/pkg/index"
 	"github.com/DerGut/zomdb/pkg/table"
 )
 
@@ -61,7 +66,7 @@ func TestTable(t *testing.T) {
 		t.Fatalf("Expected %q, got %q", "bar", name)
 	}
 
-	amount, ok := row[2].(uint64)
+	amount, ok := row[2].(int64)
 	if !ok {
 		t.Fatalf("Expected int type, got %T", row[2])
 	}
@@ -70,3 +75,929 @@ func TestTable(t *testing.T) {
 		t.Fatalf("Expected %d, got %d", 16, amount)
 	}
 }
+
+func TestTableDelete(t *testing.T) {
+	tbl := newTestTable(t, [][]any{
+		{"id1", "foo", 3},
+		{"id2", "bar", 16},
+		{"id3", "foo", 39},
+	})
+
+	n, err := tbl.Delete([]table.Predicate{{ColumnName: "name", Value: "foo"}})
+	if err != nil {
+		t.Fatalf("delete name=foo: %v", err)
+	}
+
+	if n != 2 {
+		t.Fatalf("Expected 2 deleted rows, got %d", n)
+	}
+
+	n, err = tbl.Delete([]table.Predicate{{ColumnName: "name", Value: "foo"}})
+	if err != nil {
+		t.Fatalf("delete name=foo again: %v", err)
+	}
+
+	if n != 0 {
+		t.Fatalf("Expected 0 deleted rows, got %d", n)
+	}
+
+	n, err = tbl.Delete([]table.Predicate{{ColumnName: "id", Value: "id2"}})
+	if err != nil {
+		t.Fatalf("delete id=id2: %v", err)
+	}
+
+	if n != 1 {
+		t.Fatalf("Expected 1 deleted row, got %d", n)
+	}
+
+	for _, id := range []string{"id1", "id2", "id3"} {
+		if _, err := tbl.Select([]table.Predicate{{ColumnName: "id", Value: id}}); !errors.Is(err, table.ErrNotFound) {
+			t.Fatalf("select id=%s: expected ErrNotFound, got %v", id, err)
+		}
+	}
+
+	if _, err := tbl.Delete([]table.Predicate{{ColumnName: "id", Value: "id2"}}); !errors.Is(err, table.ErrNotFound) {
+		t.Fatalf("delete id=id2 again: expected ErrNotFound, got %v", err)
+	}
+}
+
+func newTestTable(t *testing.T, rows [][]any) *table.Table {
+	spec := table.Spec{
+		Name: filepath.Join(t.TempDir(), "test"),
+		Columns: []table.Column{
+			{Name: "id", Type: table.ColumnTypeString, PrimaryKey: true},
+			{Name: "name", Type: table.ColumnTypeString},
+			{Name: "amount", Type: table.ColumnTypeInt64},
+		},
+	}
+
+	tbl, err := table.New(spec)
+	if err != nil {
+		t.Fatal("new table", err)
+	}
+
+	for i, row := range rows {
+		if err := tbl.Insert(row); err != nil {
+			t.Fatalf("insert row %d: %v\n", i, err)
+		}
+	}
+
+	return tbl
+}
+
+func TestTableUpdate(t *testing.T) {
+	tbl := newTestTable(t, [][]any{
+		{"id1", "foo", 3},
+		{"id2", "bar", 16},
+		{"id3", "foo", 39},
+	})
+
+	n, err := tbl.Update(
+		[]table.Assignment{{ColumnName: "amount", Value: 42}},
+		[]table.Predicate{{ColumnName: "name", Value: "foo"}},
+	)
+	if err != nil {
+		t.Fatalf("update name=foo: %v", err)
+	}
+
+	if n != 2 {
+		t.Fatalf("Expected 2 updated rows, got %d", n)
+	}
+
+	n, err = tbl.Update(
+		[]table.Assignment{{ColumnName: "name", Value: "baz"}},
+		[]table.Predicate{{ColumnName: "id", Value: "id2"}},
+	)
+	if err != nil {
+		t.Fatalf("update id=id2: %v", err)
+	}
+
+	if n != 1 {
+		t.Fatalf("Expected 1 updated row, got %d", n)
+	}
+
+	for id, want := range map[string][2]any{
+		"id1": {"foo", int64(42)},
+		"id2": {"baz", int64(16)},
+		"id3": {"foo", int64(42)},
+	} {
+		row, err := tbl.Select([]table.Predicate{{ColumnName: "id", Value: id}})
+		if err != nil {
+			t.Fatalf("select id=%s: %v", id, err)
+		}
+
+		if row[1] != want[0] || row[2] != want[1] {
+			t.Fatalf("id=%s: Expected %v, got %v", id, want, row[1:])
+		}
+	}
+
+	if _, err := tbl.Update(
+		[]table.Assignment{{ColumnName: "id", Value: "id4"}},
+		[]table.Predicate{{ColumnName: "id", Value: "id1"}},
+	); err == nil {
+		t.Fatal("update primary key: expected error")
+	}
+
+	if _, err := tbl.Update(
+		[]table.Assignment{{ColumnName: "amount", Value: "many"}},
+		[]table.Predicate{{ColumnName: "id", Value: "id1"}},
+	); err == nil {
+		t.Fatal("update with wrong type: expected error")
+	}
+}
+
+func TestTableSelectSequential(t *testing.T) {
+	tbl := newTestTable(t, [][]any{
+		{"id1", "foo", 3},
+		{"id2", "bar", 16},
+		{"id3", "baz", 39},
+	})
+
+	row, err := tbl.Select([]table.Predicate{{ColumnName: "amount", Value: 16}})
+	if err != nil {
+		t.Fatalf("select amount=16: %v", err)
+	}
+
+	if row[0] != "id2" {
+		t.Fatalf("Expected %q, got %q", "id2", row[0])
+	}
+
+	row, err = tbl.Select([]table.Predicate{
+		{ColumnName: "name", Value: "baz"},
+		{ColumnName: "amount", Value: 39},
+	})
+	if err != nil {
+		t.Fatalf("select name=baz,amount=39: %v", err)
+	}
+
+	if row[0] != "id3" {
+		t.Fatalf("Expected %q, got %q", "id3", row[0])
+	}
+
+	if _, err := tbl.Select([]table.Predicate{{ColumnName: "name", Value: "qux"}}); !errors.Is(err, table.ErrNotFound) {
+		t.Fatalf("select name=qux: expected ErrNotFound, got %v", err)
+	}
+
+	if _, err := tbl.Select([]table.Predicate{{ColumnName: "unknown", Value: "qux"}}); err == nil {
+		t.Fatal("select unknown column: expected error")
+	}
+}
+
+func TestTableSelectPrimaryKey(t *testing.T) {
+	tbl := newTestTable(t, [][]any{
+		{"id1", "foo", 3},
+		{"id2", "bar", 16},
+	})
+
+	row, err := tbl.Select([]table.Predicate{
+		{ColumnName: "id", Value: "id2"},
+		{ColumnName: "name", Value: "bar"},
+	})
+	if err != nil {
+		t.Fatalf("select: %v", err)
+	}
+
+	if row[0] != "id2" {
+		t.Fatalf("Expected %q, got %q", "id2", row[0])
+	}
+
+	// The primary key matches but the other predicate doesn't.
+	_, err = tbl.Select([]table.Predicate{
+		{ColumnName: "id", Value: "id2"},
+		{ColumnName: "name", Value: "foo"},
+	})
+	if !errors.Is(err, table.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestTableSelectMultiple(t *testing.T) {
+	tbl := newTestTable(t, [][]any{
+		{"id1", "foo", 3},
+		{"id2", "bar", 16},
+		{"id3", "foo", 39},
+	})
+
+	tests := []struct {
+		where []table.Predicate
+		want  []string
+	}{
+		{[]table.Predicate{{ColumnName: "name", Value: "foo"}}, []string{"id1", "id3"}},
+		{[]table.Predicate{{ColumnName: "id", Value: "id2"}}, []string{"id2"}},
+		{[]table.Predicate{{ColumnName: "id", Value: "id4"}}, nil},
+		{nil, []string{"id1", "id2", "id3"}},
+	}
+
+	for _, tt := range tests {
+		rows, err := tbl.SelectMultiple(tt.where)
+		if err != nil {
+			t.Fatalf("select %v: %v", tt.where, err)
+		}
+
+		var ids []string
+		for _, row := range rows {
+			ids = append(ids, row[0].(string))
+		}
+
+		slices.Sort(ids)
+
+		if !slices.Equal(ids, tt.want) {
+			t.Fatalf("select %v: Expected %v, got %v", tt.where, tt.want, ids)
+		}
+	}
+}
+
+func TestTableColumnTypes(t *testing.T) {
+	spec := table.Spec{
+		Name: filepath.Join(t.TempDir(), "test"),
+		Columns: []table.Column{
+			{Name: "id", Type: table.ColumnTypeString, PrimaryKey: true},
+			{Name: "reading", Type: table.ColumnTypeFloat64},
+			{Name: "active", Type: table.ColumnTypeBool},
+			{Name: "raw", Type: table.ColumnTypeBytes},
+		},
+	}
+
+	tbl, err := table.New(spec)
+	if err != nil {
+		t.Fatal("new table", err)
+	}
+
+	if err := tbl.Insert([]any{"id1", 21.5, true, []byte{0, 1, 2}}); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	if err := tbl.Insert([]any{"id2", 21, true, []byte{0, 1, 2}}); err == nil {
+		t.Fatal("insert int as float64: expected error")
+	}
+
+	row, err := tbl.Select([]table.Predicate{{ColumnName: "id", Value: "id1"}})
+	if err != nil {
+		t.Fatalf("select: %v", err)
+	}
+
+	if reading, ok := row[1].(float64); !ok || reading != 21.5 {
+		t.Fatalf("Expected float64 21.5, got %T %v", row[1], row[1])
+	}
+
+	if active, ok := row[2].(bool); !ok || !active {
+		t.Fatalf("Expected bool true, got %T %v", row[2], row[2])
+	}
+
+	if raw, ok := row[3].([]byte); !ok || !bytes.Equal(raw, []byte{0, 1, 2}) {
+		t.Fatalf("Expected []byte{0, 1, 2}, got %T %v", row[3], row[3])
+	}
+}
+
+func TestTableCount(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test")
+	spec := table.Spec{
+		Name: name,
+		Columns: []table.Column{
+			{Name: "id", Type: table.ColumnTypeString, PrimaryKey: true},
+			{Name: "name", Type: table.ColumnTypeString},
+		},
+	}
+
+	tbl, err := table.New(spec)
+	if err != nil {
+		t.Fatal("new table", err)
+	}
+
+	for i, row := range [][]any{
+		{"id1", "foo"},
+		{"id2", "bar"},
+		{"id3", "foo"},
+		{"id3", "baz"}, // overwrites id3
+	} {
+		if err := tbl.Insert(row); err != nil {
+			t.Fatalf("insert row %d: %v\n", i, err)
+		}
+	}
+
+	if _, err := tbl.Delete([]table.Predicate{{ColumnName: "id", Value: "id2"}}); err != nil {
+		t.Fatalf("delete id=id2: %v", err)
+	}
+
+	tests := []struct {
+		where []table.Predicate
+		want  int64
+	}{
+		{nil, 2},
+		{[]table.Predicate{{ColumnName: "name", Value: "foo"}}, 1},
+		{[]table.Predicate{{ColumnName: "name", Value: "bar"}}, 0},
+	}
+
+	for _, tt := range tests {
+		n, err := tbl.Count(tt.where)
+		if err != nil {
+			t.Fatalf("count %v: %v", tt.where, err)
+		}
+
+		if n != tt.want {
+			t.Fatalf("count %v: Expected %d, got %d", tt.where, tt.want, n)
+		}
+	}
+
+	// The row count is persisted on Close
+	if err := tbl.Close(); err != nil {
+		t.Fatal("close table", err)
+	}
+
+	reopened, err := table.New(spec)
+	if err != nil {
+		t.Fatal("reopen table", err)
+	}
+
+	if n, err := reopened.Count(nil); err != nil || n != 2 {
+		t.Fatalf("count after reopen: Expected 2, got %d (%v)", n, err)
+	}
+
+	// A table that wasn't closed, e.g. after a crash, is counted again
+	if err := reopened.Insert([]any{"id4", "qux"}); err != nil {
+		t.Fatal("insert after reopen", err)
+	}
+
+	crashed, err := table.New(spec)
+	if err != nil {
+		t.Fatal("reopen table", err)
+	}
+
+	if n, err := crashed.Count(nil); err != nil || n != 3 {
+		t.Fatalf("count after crash: Expected 3, got %d (%v)", n, err)
+	}
+
+	if err := crashed.Close(); err != nil {
+		t.Fatal("close table", err)
+	}
+
+	// Opening and closing a table without writes doesn't grow the heap
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 3 {
+		tbl, err := table.New(spec)
+		if err != nil {
+			t.Fatal("reopen table", err)
+		}
+
+		if n, err := tbl.Count(nil); err != nil || n != 3 {
+			t.Fatalf("count after reopen: Expected 3, got %d (%v)", n, err)
+		}
+
+		if err := tbl.Close(); err != nil {
+			t.Fatal("close table", err)
+		}
+	}
+
+	after, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if after.Size() != info.Size() {
+		t.Fatalf("heap size: Expected %d, got %d", info.Size(), after.Size())
+	}
+}
+
+func TestTablePredicateOps(t *testing.T) {
+	tbl := newTestTable(t, [][]any{
+		{"id1", "foo", 3},
+		{"id2", "bar", 16},
+		{"id3", "baz", 39},
+	})
+
+	tests := []struct {
+		where []table.Predicate
+		want  []string
+	}{
+		{[]table.Predicate{{ColumnName: "amount", Op: table.OpGT, Value: 3}}, []string{"id2", "id3"}},
+		{[]table.Predicate{{ColumnName: "amount", Op: table.OpGTE, Value: 16}}, []string{"id2", "id3"}},
+		{[]table.Predicate{{ColumnName: "amount", Op: table.OpLT, Value: 16}}, []string{"id1"}},
+		{[]table.Predicate{{ColumnName: "amount", Op: table.OpLTE, Value: 16}}, []string{"id1", "id2"}},
+		{[]table.Predicate{{ColumnName: "name", Op: table.OpNE, Value: "bar"}}, []string{"id1", "id3"}},
+		{[]table.Predicate{{ColumnName: "name", Op: table.OpLT, Value: "baz"}}, []string{"id2"}},
+		{[]table.Predicate{{ColumnName: "id", Op: table.OpGT, Value: "id1"}}, []string{"id2", "id3"}},
+		{[]table.Predicate{
+			{ColumnName: "amount", Op: table.OpGT, Value: 3},
+			{ColumnName: "amount", Op: table.OpLT, Value: 39},
+		}, []string{"id2"}},
+	}
+
+	for _, tt := range tests {
+		rows, err := tbl.SelectMultiple(tt.where)
+		if err != nil {
+			t.Fatalf("select %v: %v", tt.where, err)
+		}
+
+		var ids []string
+		for _, row := range rows {
+			ids = append(ids, row[0].(string))
+		}
+
+		slices.Sort(ids)
+
+		if !slices.Equal(ids, tt.want) {
+			t.Fatalf("select %v: Expected %v, got %v", tt.where, tt.want, ids)
+		}
+	}
+
+	if _, err := tbl.SelectMultiple([]table.Predicate{{ColumnName: "amount", Op: table.OpGT, Value: "3"}}); err == nil {
+		t.Fatal("compare int64 with string: expected error")
+	}
+}
+
+func TestTableUpsert(t *testing.T) {
+	tbl := newTestTable(t, [][]any{
+		{"id1", "foo", 3},
+	})
+
+	for i, row := range [][]any{
+		{"id1", "bar", 16},
+		{"id2", "baz", 39},
+	} {
+		if err := tbl.Upsert(row); err != nil {
+			t.Fatalf("upsert row %d: %v", i, err)
+		}
+	}
+
+	row, err := tbl.Select([]table.Predicate{{ColumnName: "id", Value: "id1"}})
+	if err != nil {
+		t.Fatalf("select id=id1: %v", err)
+	}
+
+	if row[1] != "bar" || row[2] != int64(16) {
+		t.Fatalf("Expected [bar 16], got %v", row[1:])
+	}
+
+	if n, err := tbl.Count(nil); err != nil || n != 2 {
+		t.Fatalf("count: Expected 2, got %d (%v)", n, err)
+	}
+
+	if err := tbl.Upsert([]any{"id3", "qux"}); err == nil {
+		t.Fatal("upsert with missing column: expected error")
+	}
+
+	if err := tbl.Upsert([]any{"id3", "qux", "many"}); err == nil {
+		t.Fatal("upsert with wrong type: expected error")
+	}
+}
+
+func TestTableAggregate(t *testing.T) {
+	tbl := newTestTable(t, [][]any{
+		{"id1", "foo", 3},
+		{"id2", "bar", 16},
+		{"id3", "foo", 41},
+	})
+
+	tests := []struct {
+		fn    table.AggregateFunc
+		col   string
+		where []table.Predicate
+		want  any
+	}{
+		{table.AggregateSum, "amount", nil, int64(60)},
+		{table.AggregateAvg, "amount", nil, 20.0},
+		{table.AggregateMin, "amount", nil, int64(3)},
+		{table.AggregateMax, "amount", nil, int64(41)},
+		{table.AggregateMin, "name", nil, "bar"},
+		{table.AggregateSum, "amount", []table.Predicate{{ColumnName: "name", Value: "foo"}}, int64(44)},
+	}
+
+	for _, tt := range tests {
+		got, err := tbl.Aggregate(tt.fn, tt.col, tt.where)
+		if err != nil {
+			t.Fatalf("aggregate %d(%s): %v", tt.fn, tt.col, err)
+		}
+
+		if got != tt.want {
+			t.Fatalf("aggregate %d(%s): Expected %v, got %v", tt.fn, tt.col, tt.want, got)
+		}
+	}
+
+	if _, err := tbl.Aggregate(table.AggregateSum, "name", nil); err == nil {
+		t.Fatal("sum over string column: expected error")
+	}
+
+	_, err := tbl.Aggregate(table.AggregateSum, "amount", []table.Predicate{{ColumnName: "name", Value: "qux"}})
+	if !errors.Is(err, table.ErrNotFound) {
+		t.Fatalf("sum over no rows: expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestTableSelectOrderBy(t *testing.T) {
+	tbl := newTestTable(t, [][]any{
+		{"id1", "foo", 16},
+		{"id2", "bar", 3},
+		{"id3", "baz", 39},
+	})
+
+	tests := []struct {
+		opts table.SelectOptions
+		want []string
+	}{
+		{table.SelectOptions{OrderBy: "amount"}, []string{"id2", "id1", "id3"}},
+		{table.SelectOptions{OrderBy: "amount", Desc: true}, []string{"id3", "id1", "id2"}},
+		{table.SelectOptions{OrderBy: "name"}, []string{"id2", "id3", "id1"}},
+	}
+
+	for _, tt := range tests {
+		rows, err := tbl.SelectMultipleWithOptions(nil, tt.opts)
+		if err != nil {
+			t.Fatalf("select %+v: %v", tt.opts, err)
+		}
+
+		var ids []string
+		for _, row := range rows {
+			ids = append(ids, row[0].(string))
+		}
+
+		if !slices.Equal(ids, tt.want) {
+			t.Fatalf("select %+v: Expected %v, got %v", tt.opts, tt.want, ids)
+		}
+	}
+
+	if _, err := tbl.SelectMultipleWithOptions(nil, table.SelectOptions{OrderBy: "unknown"}); err == nil {
+		t.Fatal("order by unknown column: expected error")
+	}
+}
+
+func TestTableSelectLimitOffset(t *testing.T) {
+	tbl := newTestTable(t, [][]any{
+		{"id1", "foo", 16},
+		{"id2", "bar", 3},
+		{"id3", "baz", 39},
+		{"id4", "qux", 7},
+	})
+
+	tests := []struct {
+		opts table.SelectOptions
+		want []string
+	}{
+		{table.SelectOptions{OrderBy: "amount", Limit: 2}, []string{"id2", "id4"}},
+		{table.SelectOptions{OrderBy: "amount", Offset: 1, Limit: 2}, []string{"id4", "id1"}},
+		{table.SelectOptions{OrderBy: "amount", Offset: 3}, []string{"id3"}},
+		{table.SelectOptions{OrderBy: "amount", Offset: 5}, nil},
+	}
+
+	for _, tt := range tests {
+		rows, err := tbl.SelectMultipleWithOptions(nil, tt.opts)
+		if err != nil {
+			t.Fatalf("select %+v: %v", tt.opts, err)
+		}
+
+		var ids []string
+		for _, row := range rows {
+			ids = append(ids, row[0].(string))
+		}
+
+		if !slices.Equal(ids, tt.want) {
+			t.Fatalf("select %+v: Expected %v, got %v", tt.opts, tt.want, ids)
+		}
+	}
+
+	// Without ordering, pages don't overlap.
+	seen := map[string]bool{}
+	for offset := 0; offset < 4; offset += 2 {
+		rows, err := tbl.SelectMultipleWithOptions(nil, table.SelectOptions{Offset: offset, Limit: 2})
+		if err != nil {
+			t.Fatalf("select offset %d: %v", offset, err)
+		}
+
+		if len(rows) != 2 {
+			t.Fatalf("select offset %d: Expected 2 rows, got %d", offset, len(rows))
+		}
+
+		for _, row := range rows {
+			seen[row[0].(string)] = true
+		}
+	}
+
+	if len(seen) != 4 {
+		t.Fatalf("Expected 4 distinct rows, got %v", seen)
+	}
+}
+
+// countingIndex counts lookups to verify that an index was used.
+type countingIndex struct {
+	index.Hash
+	gets int
+}
+
+func (c *countingIndex) GetOffset(key []byte) (int64, error) {
+	c.gets++
+	return c.Hash.GetOffset(key)
+}
+
+func TestTableCreateIndex(t *testing.T) {
+	tbl := newTestTable(t, [][]any{
+		{"id1", "foo", 3},
+		{"id2", "bar", 16},
+	})
+
+	idx := &countingIndex{}
+	if err := tbl.CreateIndex("name", idx); err != nil {
+		t.Fatalf("create index: %v", err)
+	}
+
+	if err := tbl.CreateIndex("name", &index.Hash{}); err == nil {
+		t.Fatal("create index twice: expected error")
+	}
+
+	if err := tbl.Insert([]any{"id3", "baz", 39}); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	for name, want := range map[string]string{"foo": "id1", "bar": "id2", "baz": "id3"} {
+		row, err := tbl.Select([]table.Predicate{{ColumnName: "name", Value: name}})
+		if err != nil {
+			t.Fatalf("select name=%s: %v", name, err)
+		}
+
+		if row[0] != want {
+			t.Fatalf("select name=%s: Expected %q, got %q", name, want, row[0])
+		}
+	}
+
+	if idx.gets != 3 {
+		t.Fatalf("Expected 3 index lookups, got %d", idx.gets)
+	}
+
+	if _, err := tbl.Select([]table.Predicate{{ColumnName: "name", Value: "qux"}}); !errors.Is(err, table.ErrNotFound) {
+		t.Fatalf("select name=qux: expected ErrNotFound, got %v", err)
+	}
+
+	// Updates move rows within the index
+	if _, err := tbl.Update(
+		[]table.Assignment{{ColumnName: "name", Value: "qux"}},
+		[]table.Predicate{{ColumnName: "id", Value: "id1"}},
+	); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	row, err := tbl.Select([]table.Predicate{{ColumnName: "name", Value: "qux"}})
+	if err != nil {
+		t.Fatalf("select name=qux: %v", err)
+	}
+
+	if row[0] != "id1" {
+		t.Fatalf("select name=qux: Expected %q, got %q", "id1", row[0])
+	}
+
+	if _, err := tbl.Select([]table.Predicate{{ColumnName: "name", Value: "foo"}}); !errors.Is(err, table.ErrNotFound) {
+		t.Fatalf("select name=foo after update: expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestTableExplainSelect(t *testing.T) {
+	tbl := newTestTable(t, nil)
+
+	if err := tbl.CreateIndex("name", &index.Hash{}); err != nil {
+		t.Fatalf("create index: %v", err)
+	}
+
+	tests := []struct {
+		where []table.Predicate
+		want  string
+	}{
+		{nil, "sequential scan"},
+		{[]table.Predicate{{ColumnName: "id", Value: "id1"}}, "index scan on id"},
+		{[]table.Predicate{{ColumnName: "amount", Value: 3}, {ColumnName: "name", Value: "foo"}}, "secondary index scan on name"},
+		{[]table.Predicate{{ColumnName: "name", Value: "foo", Op: table.OpGT}}, "sequential scan (no index for column: name)"},
+		{[]table.Predicate{{ColumnName: "id", Value: "id1", Op: table.OpLT}, {ColumnName: "amount", Value: 3}}, "sequential scan (no index for column: id, amount)"},
+	}
+
+	for _, tt := range tests {
+		if got := tbl.ExplainSelect(tt.where); got != tt.want {
+			t.Fatalf("explain %v: Expected %q, got %q", tt.where, tt.want, got)
+		}
+	}
+}
+
+func TestTableDeleteIndexed(t *testing.T) {
+	tbl := newTestTable(t, [][]any{
+		{"id1", "foo", 3},
+		{"id2", "foo", 16},
+		{"id3", "bar", 39},
+	})
+
+	idx := &countingIndex{}
+	if err := tbl.CreateIndex("name", idx); err != nil {
+		t.Fatalf("create index: %v", err)
+	}
+
+	for _, id := range []string{"id1", "id2"} {
+		if _, err := tbl.Delete([]table.Predicate{{ColumnName: "id", Value: id}}); err != nil {
+			t.Fatalf("delete %s: %v", id, err)
+		}
+
+		// The other row with the same value must still be found.
+		rows, err := tbl.SelectMultiple([]table.Predicate{{ColumnName: "name", Value: "foo"}})
+		if err != nil {
+			t.Fatalf("select name=foo: %v", err)
+		}
+
+		row, err := tbl.Select([]table.Predicate{{ColumnName: "name", Value: "foo"}})
+		if len(rows) == 0 {
+			if !errors.Is(err, table.ErrNotFound) {
+				t.Fatalf("select name=foo: expected ErrNotFound, got %v", err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("select name=foo: %v", err)
+		}
+
+		if row[0] != rows[0][0] {
+			t.Fatalf("select name=foo: Expected %q, got %q", rows[0][0], row[0])
+		}
+	}
+
+	if _, err := idx.Hash.GetOffset([]byte("\x01\x01\x03foo")); !errors.Is(err, index.ErrNotFound) {
+		t.Fatalf("expected index entry to be deleted, got %v", err)
+	}
+
+	row, err := tbl.Select([]table.Predicate{{ColumnName: "name", Value: "bar"}})
+	if err != nil {
+		t.Fatalf("select name=bar: %v", err)
+	}
+
+	if row[0] != "id3" {
+		t.Fatalf("select name=bar: Expected %q, got %q", "id3", row[0])
+	}
+}
+
+func TestTableDrop(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test")
+	tbl, err := table.New(table.Spec{
+		Name: name,
+		Columns: []table.Column{
+			{Name: "id", Type: table.ColumnTypeString, PrimaryKey: true},
+		},
+	})
+	if err != nil {
+		t.Fatal("new table", err)
+	}
+
+	if err := tbl.Insert([]any{"id1"}); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	if err := tbl.Drop(); err != nil {
+		t.Fatalf("drop: %v", err)
+	}
+
+	if _, err := os.Stat(name); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected heap file to be removed, got %v", err)
+	}
+
+	if _, err := tbl.Select(nil); !errors.Is(err, table.ErrDropped) {
+		t.Fatalf("select: expected ErrDropped, got %v", err)
+	}
+
+	if err := tbl.Insert([]any{"id2"}); !errors.Is(err, table.ErrDropped) {
+		t.Fatalf("insert: expected ErrDropped, got %v", err)
+	}
+
+	if err := tbl.Drop(); !errors.Is(err, table.ErrDropped) {
+		t.Fatalf("drop twice: expected ErrDropped, got %v", err)
+	}
+}
+
+func TestTableSchema(t *testing.T) {
+	spec := table.Spec{
+		Name: filepath.Join(t.TempDir(), "test"),
+		Columns: []table.Column{
+			{Name: "id", Type: table.ColumnTypeString, PrimaryKey: true},
+			{Name: "amount", Type: table.ColumnTypeInt64},
+		},
+	}
+
+	tbl, err := table.New(spec)
+	if err != nil {
+		t.Fatal("new table", err)
+	}
+
+	if err := tbl.Insert([]any{"id1", 3}); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	if _, err := table.New(spec); err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+
+	for _, columns := range [][]table.Column{
+		{spec.Columns[1], spec.Columns[0]},
+		{spec.Columns[0], {Name: "amount", Type: table.ColumnTypeFloat64}},
+		{spec.Columns[0]},
+	} {
+		mismatched := table.Spec{Name: spec.Name, Columns: columns}
+		if _, err := table.New(mismatched); !errors.Is(err, table.ErrSchemaMismatch) {
+			t.Fatalf("columns %v: expected ErrSchemaMismatch, got %v", columns, err)
+		}
+	}
+
+	if err := tbl.Drop(); err != nil {
+		t.Fatalf("drop: %v", err)
+	}
+
+	if _, err := os.Stat(spec.Name + ".schema"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected schema file to be removed, got %v", err)
+	}
+}
+
+func TestTableNullable(t *testing.T) {
+	spec := table.Spec{
+		Name: filepath.Join(t.TempDir(), "test"),
+		Columns: []table.Column{
+			{Name: "id", Type: table.ColumnTypeString, PrimaryKey: true},
+			{Name: "name", Type: table.ColumnTypeString},
+			{Name: "amount", Type: table.ColumnTypeInt64, Nullable: true},
+		},
+	}
+
+	tbl, err := table.New(spec)
+	if err != nil {
+		t.Fatal("new table", err)
+	}
+
+	for i, row := range [][]any{
+		{"id1", "foo", 3},
+		{"id2", "bar", table.NullValue{}},
+		{"id3", "baz", 39},
+	} {
+		if err := tbl.Insert(row); err != nil {
+			t.Fatalf("insert row %d: %v\n", i, err)
+		}
+	}
+
+	if err := tbl.Insert([]any{"id4", table.NullValue{}, 1}); !errors.Is(err, table.ErrNotNullViolation) {
+		t.Fatalf("insert NULL into non-nullable column: expected ErrNotNullViolation, got %v", err)
+	}
+
+	row, err := tbl.Select([]table.Predicate{{ColumnName: "id", Value: "id2"}})
+	if err != nil {
+		t.Fatalf("select: %v", err)
+	}
+
+	if row[2] != (table.NullValue{}) {
+		t.Fatalf("Expected NULL, got %v", row[2])
+	}
+
+	// NULL doesn't match comparisons with values, only with NULL.
+	n, err := tbl.Count([]table.Predicate{{ColumnName: "amount", Value: 100, Op: table.OpLT}})
+	if err != nil {
+		t.Fatalf("count: %v", err)
+	}
+
+	if n != 2 {
+		t.Fatalf("Expected 2 rows with amount < 100, got %d", n)
+	}
+
+	row, err = tbl.Select([]table.Predicate{{ColumnName: "amount", Value: table.NullValue{}}})
+	if err != nil {
+		t.Fatalf("select amount=NULL: %v", err)
+	}
+
+	if row[0] != "id2" {
+		t.Fatalf("select amount=NULL: Expected %q, got %q", "id2", row[0])
+	}
+
+	avg, err := tbl.Aggregate(table.AggregateAvg, "amount", nil)
+	if err != nil {
+		t.Fatalf("aggregate: %v", err)
+	}
+
+	if avg != 21.0 {
+		t.Fatalf("Expected average of 21 ignoring NULL, got %v", avg)
+	}
+
+	rows, err := tbl.SelectMultipleWithOptions(nil, table.SelectOptions{OrderBy: "amount"})
+	if err != nil {
+		t.Fatalf("select ordered: %v", err)
+	}
+
+	if rows[0][0] != "id2" {
+		t.Fatalf("Expected NULL to sort first, got %v", rows[0])
+	}
+
+	if _, err := tbl.Update(
+		[]table.Assignment{{ColumnName: "name", Value: table.NullValue{}}},
+		[]table.Predicate{{ColumnName: "id", Value: "id1"}},
+	); !errors.Is(err, table.ErrNotNullViolation) {
+		t.Fatalf("update to NULL: expected ErrNotNullViolation, got %v", err)
+	}
+
+	if _, err := table.New(table.Spec{
+		Name: filepath.Join(t.TempDir(), "test"),
+		Columns: []table.Column{
+			{Name: "id", Type: table.ColumnTypeString, PrimaryKey: true, Nullable: true},
+		},
+	}); err == nil {
+		t.Fatal("nullable primary key: expected error")
+	}
+}
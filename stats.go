@@ -0,0 +1,40 @@
+package zomdb
+
+import "os"
+
+// Stats holds runtime statistics of a DB.
+type Stats struct {
+	// KeyCount is the number of live keys. It is computed by scanning the
+	// heap and may be lower than the actual count if the scan fails.
+	KeyCount int64
+	// DiskBytes is the size of the heap file, including overwritten and
+	// deleted pairs.
+	DiskBytes int64
+	// ReadOps is the number of reads since the DB was opened.
+	ReadOps uint64
+	// WriteOps is the number of writes since the DB was opened. Writes of
+	// transactions and batches are counted individually.
+	WriteOps uint64
+}
+
+// Stats returns the current statistics of the DB. It scans all keys and is
+// therefore as expensive as a full Scan.
+func (d *DB) Stats() Stats {
+	stats := Stats{
+		ReadOps:  d.readOps.Load(),
+		WriteOps: d.writeOps.Load(),
+	}
+
+	if info, err := os.Stat(d.path); err == nil {
+		stats.DiskBytes = info.Size()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for range d.heap.All() {
+		stats.KeyCount++
+	}
+
+	return stats
+}
@@ -0,0 +1,123 @@
+package zomdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/DerGut/zomdb/pkg/heap"
+)
+
+// ErrTxDone is returned when using a transaction that was already committed
+// or rolled back.
+var ErrTxDone = errors.New("transaction already committed or rolled back")
+
+// Tx buffers writes to multiple keys and applies them together on Commit.
+//
+// Writes are applied under the DB's write lock, so other writers never see
+// a partially applied transaction. Reads outside of the transaction aren't
+// isolated from concurrent writes, and a failing write during Commit leaves
+// the writes before it applied.
+type Tx struct {
+	db *DB
+
+	// writes maps keys to their pending values. A nil value marks a
+	// deletion.
+	writes map[string][]byte
+	done   bool
+}
+
+// Begin starts a new transaction.
+func (d *DB) Begin() (*Tx, error) {
+	return &Tx{db: d, writes: make(map[string][]byte)}, nil
+}
+
+// Get returns the value of the key as seen by the transaction, including
+// its own pending writes.
+func (t *Tx) Get(ctx context.Context, key []byte) ([]byte, error) {
+	if t.done {
+		return nil, ErrTxDone
+	}
+
+	if value, ok := t.writes[string(key)]; ok {
+		if value == nil {
+			return nil, ErrNotFound
+		}
+
+		return bytes.Clone(value), nil
+	}
+
+	return t.db.Get(ctx, key)
+}
+
+// Set buffers a write of the key until Commit.
+func (t *Tx) Set(_ context.Context, key []byte, value []byte) error {
+	if t.done {
+		return ErrTxDone
+	}
+
+	if value == nil {
+		// nil marks deletions, store an empty value instead.
+		value = []byte{}
+	}
+
+	t.writes[string(key)] = bytes.Clone(value)
+
+	return nil
+}
+
+// Delete buffers a deletion of the key until Commit. Deleting a key that
+// doesn't exist is not an error.
+func (t *Tx) Delete(_ context.Context, key []byte) error {
+	if t.done {
+		return ErrTxDone
+	}
+
+	t.writes[string(key)] = nil
+
+	return nil
+}
+
+// Commit applies all buffered writes. The transaction can't be used
+// afterwards.
+func (t *Tx) Commit() error {
+	if t.done {
+		return ErrTxDone
+	}
+	t.done = true
+
+	t.db.writeOps.Add(uint64(len(t.writes)))
+
+	t.db.mu.Lock()
+	defer t.db.mu.Unlock()
+
+	for key, value := range t.writes {
+		if value == nil {
+			err := t.db.heap.Delete([]byte(key))
+			if err != nil && !errors.Is(err, heap.ErrNotFound) {
+				return fmt.Errorf("deleting %q: %w", key, err)
+			}
+
+			continue
+		}
+
+		if err := t.db.heap.Set([]byte(key), value); err != nil {
+			return fmt.Errorf("setting %q: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+// Rollback discards all buffered writes. The transaction can't be used
+// afterwards.
+func (t *Tx) Rollback() error {
+	if t.done {
+		return ErrTxDone
+	}
+	t.done = true
+	t.writes = nil
+
+	return nil
+}
@@ -2,37 +2,150 @@ package zomdb
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"iter"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 
 	"github.com/DerGut/zomdb/pkg/heap"
 )
 
+// ErrNotFound is returned for keys that don't exist.
+var ErrNotFound = errors.New("not found")
+
 type DB struct {
+	path string
+	// tempDir is the directory created by NewTemp, it's removed on Close.
+	tempDir string
+
+	// mu serializes all access to the heap, so that transactions are
+	// applied without interleaving with other writes. The heap isn't safe
+	// for concurrent reads either: the cgo heap seeks a shared file handle
+	// and iterations record their error on the heap.
+	mu   sync.Mutex
 	heap *heap.Heap
+
+	readOps  atomic.Uint64
+	writeOps atomic.Uint64
+}
+
+// New opens the database stored at path or creates it if it doesn't exist
+// yet.
+func New(path string) (*DB, error) {
+	h, err := heap.Open(path)
+	if errors.Is(err, heap.ErrNotFound) {
+		h, err = heap.New(path)
+		if err != nil {
+			return nil, fmt.Errorf("creating heap: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("opening heap: %w", err)
+	}
+
+	return &DB{path: path, heap: h}, nil
 }
 
-func New() (*DB, error) {
-	name := filepath.Join(os.TempDir(), "heap.zomdb")
+// NewTemp creates an empty database in a new temporary directory, so that
+// callers never share state. It is meant for tests and examples, the
+// directory is removed on Close.
+func NewTemp() (*DB, error) {
+	dir, err := os.MkdirTemp("", "zomdb")
+	if err != nil {
+		return nil, fmt.Errorf("creating temp dir: %w", err)
+	}
 
-	h, err := heap.New(name)
+	d, err := New(filepath.Join(dir, "heap.zomdb"))
 	if err != nil {
-		return nil, fmt.Errorf("creating heap: %w", err)
+		os.RemoveAll(dir)
+		return nil, err
 	}
 
-	return &DB{heap: h}, nil
+	d.tempDir = dir
+
+	return d, nil
 }
 
 func (d *DB) Close() error {
-	d.heap.Close()
+	if err := d.heap.Close(); err != nil {
+		return fmt.Errorf("closing heap: %w", err)
+	}
+
+	if d.tempDir != "" {
+		if err := os.RemoveAll(d.tempDir); err != nil {
+			return fmt.Errorf("removing temp dir: %w", err)
+		}
+	}
+
 	return nil
 }
 
 func (d *DB) Get(_ context.Context, key []byte) ([]byte, error) {
-	return d.heap.Get(key)
+	d.readOps.Add(1)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	value, err := d.heap.Get(key)
+	if errors.Is(err, heap.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+
+	return value, err
 }
 
 func (d *DB) Set(_ context.Context, key []byte, value []byte) error {
+	d.writeOps.Add(1)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
 	return d.heap.Set(key, value)
 }
+
+// Scan returns an iterator over all pairs with lo <= key <= hi in key order.
+// A nil lo or hi leaves that side of the range unbounded. The iteration
+// stops once ctx is cancelled.
+//
+// Pairs are read in batches, the scan doesn't hold all matching pairs in
+// memory at once.
+func (d *DB) Scan(ctx context.Context, lo, hi []byte) iter.Seq2[[]byte, []byte] {
+	return func(yield func(k, v []byte) bool) {
+		// The heap is only read while next runs, so the lock is released
+		// while the caller handles a pair and may call back into the DB.
+		next, stop := iter.Pull2(d.heap.Range(lo, hi))
+		defer func() {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+
+			stop()
+		}()
+
+		for ctx.Err() == nil {
+			d.mu.Lock()
+			key, value, ok := next()
+			d.mu.Unlock()
+
+			if !ok || !yield(key, value) {
+				return
+			}
+		}
+	}
+}
+
+// Delete removes the key. It returns ErrNotFound if the key doesn't exist.
+func (d *DB) Delete(_ context.Context, key []byte) error {
+	d.writeOps.Add(1)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	err := d.heap.Delete(key)
+	if errors.Is(err, heap.ErrNotFound) {
+		return ErrNotFound
+	}
+
+	return err
+}
@@ -0,0 +1,133 @@
+package zomdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestNewTemp(t *testing.T) {
+	ctx := context.Background()
+
+	a, err := NewTemp()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := NewTemp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if err := a.Set(ctx, []byte("key"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.Get(ctx, []byte("key")); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got error %v, want %v", err, ErrNotFound)
+	}
+
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(a.tempDir); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("temp dir %s wasn't removed: %v", a.tempDir, err)
+	}
+}
+
+func TestScanConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := NewTemp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := range 100 {
+		if err := db.Set(ctx, []byte(fmt.Sprintf("key_%03d", i)), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan error)
+	go func() {
+		for i := range 100 {
+			if err := db.Set(ctx, []byte(fmt.Sprintf("other_%03d", i)), []byte("value")); err != nil {
+				done <- err
+				return
+			}
+		}
+
+		done <- nil
+	}()
+
+	var n int
+	for key := range db.Scan(ctx, []byte("key_"), []byte("key_999")) {
+		// The loop body may call back into the DB.
+		if _, err := db.Get(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+
+		n++
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 100 {
+		t.Fatalf("got %d keys, want 100", n)
+	}
+}
+
+func TestGetConcurrent(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := NewTemp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := range 10 {
+		if err := db.Set(ctx, []byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("value_%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range 100 {
+				key := fmt.Sprintf("key_%d", i%10)
+				value, err := db.Get(ctx, []byte(key))
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				if want := fmt.Sprintf("value_%d", i%10); string(value) != want {
+					errs <- fmt.Errorf("got %q for key %q, want %q", value, key, want)
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+}